@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ibfd.org/docsan/codes"
+	"ibfd.org/docsan/config"
+	log "ibfd.org/docsan/log4u"
+)
+
+// These constants define the paths of the admin endpoints.
+const (
+	levelsPath = "/admin/log/levels"
+	statsPath  = "/admin/log/stats"
+)
+
+// logStats defines the statistics of the asynchronous log writer.
+type logStats struct {
+	Async    bool   `json:"async"`
+	Overflow string `json:"overflow,omitempty"`
+	Capacity int    `json:"capacity"`
+	Queued   int    `json:"queued"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// logLevels defines the log levels as read and changed through the admin endpoint.
+type logLevels struct {
+	Level       string     `json:"level,omitempty"`
+	Levels      *string    `json:"levels,omitempty"`
+	RevertAfter string     `json:"revert_after,omitempty"`
+	RevertAt    *time.Time `json:"revert_at,omitempty"`
+}
+
+// levelReverter restores the log levels after a temporary change.
+// The levels from before the first pending change are restored.
+type levelReverter struct {
+	mu       sync.Mutex
+	timer    *time.Timer
+	revertAt time.Time
+	level    string
+	levels   string
+	pending  int // identifies the pending revert; a timer only reverts its own change
+}
+
+var reverter = &levelReverter{}
+
+// adminHandler protects an admin endpoint with the configured bearer token.
+// The endpoint is not found if no token is configured.
+func adminHandler(handle http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := config.Current().AdminToken()
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			appLog.Log(codes.AdminDenied, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="docsan"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		handle(w, r)
+	}
+}
+
+// handleLevels reads the log levels on GET and changes them on PUT or POST.
+func handleLevels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT", "POST":
+		var change logLevels
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			writeError(w, 400, fmt.Sprintf("invalid levels: %v", err))
+			return
+		}
+		if err := reverter.change(&change, r.RemoteAddr); err != nil {
+			writeError(w, 400, err.Error())
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeAdminJSON(w, r, reverter.current())
+}
+
+// handleLogStats reports the queue and the dropped messages of the log writer.
+func handleLogStats(w http.ResponseWriter, r *http.Request) {
+	stats := &logStats{}
+	if writer := config.LogWriter(); writer != nil {
+		stats = &logStats{true, writer.Policy().String(), writer.Capacity(), writer.Queued(), writer.Dropped()}
+	}
+	writeAdminJSON(w, r, stats)
+}
+
+// writeAdminJSON writes the response of an admin endpoint.
+func writeAdminJSON(w http.ResponseWriter, r *http.Request, response interface{}) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		writeServerError(w, r, appLog, fmt.Errorf("failed to write response: %v", err))
+		return
+	}
+	setServer(w)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+// change validates and applies a change of the log levels. If the change
+// must be reverted after some time then the current levels are saved
+// unless an earlier change is still pending.
+func (lr *levelReverter) change(change *logLevels, client string) error {
+	var revertAfter time.Duration
+	if change.RevertAfter != "" {
+		var err error
+		if revertAfter, err = time.ParseDuration(change.RevertAfter); err != nil || revertAfter <= 0 {
+			return fmt.Errorf("invalid revert_after %s", change.RevertAfter)
+		}
+	}
+	if change.Level != "" && !log.ValidLevel(change.Level) {
+		return fmt.Errorf("unknown level %s", change.Level)
+	}
+	if change.Levels != nil {
+		if _, err := log.ParseLevels(*change.Levels); err != nil {
+			return err
+		}
+	}
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.timer == nil {
+		lr.level, lr.levels = log.Level(), log.Levels()
+	} else {
+		lr.stop()
+	}
+	if change.Level != "" {
+		log.SetLevel(change.Level)
+	}
+	if change.Levels != nil {
+		log.SetLevels(*change.Levels)
+	}
+	appLog.Log(codes.LevelsChanged, client, log.Level(), log.Levels())
+	if revertAfter > 0 {
+		lr.revertAt = time.Now().Add(revertAfter)
+		pending := lr.pending
+		lr.timer = time.AfterFunc(revertAfter, func() { lr.revert(pending) })
+	}
+	return nil
+}
+
+// stop stops the pending revert, also if its timer already fired.
+// The caller must hold the lock.
+func (lr *levelReverter) stop() {
+	lr.timer.Stop()
+	lr.timer = nil
+	lr.pending++
+}
+
+// cancel drops the pending revert, so levels set by other means,
+// such as a reload of the config, are not overwritten.
+func (lr *levelReverter) cancel() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.timer != nil {
+		lr.stop()
+	}
+}
+
+// revert restores the saved log levels unless the pending revert
+// was stopped or replaced in the meantime.
+func (lr *levelReverter) revert(pending int) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if pending != lr.pending || lr.timer == nil {
+		return
+	}
+	lr.pending++
+	log.SetLevel(lr.level)
+	log.SetLevels(lr.levels)
+	lr.timer = nil
+	appLog.Log(codes.LevelsReverted, log.Level(), log.Levels())
+}
+
+// current returns the current log levels and when they are reverted.
+func (lr *levelReverter) current() *logLevels {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	levels := log.Levels()
+	current := &logLevels{Level: log.Level(), Levels: &levels}
+	if lr.timer != nil {
+		revertAt := lr.revertAt
+		current.RevertAt = &revertAt
+	}
+	return current
+}
@@ -0,0 +1,57 @@
+// Package codes defines the catalogue of message codes docsan logs.
+// Every code has a default severity that operators can override in
+// the logging section of the config file.
+package codes
+
+import (
+	log "ibfd.org/docsan/log4u"
+)
+
+// These codes report on the service.
+var (
+	ServerStarted   = log.NewCode("DS1000", log.Linfo, "the service started listening", "%s started on %s")
+	TransformTiming = log.NewCode("DS1001", log.Ldebug, "the time a transformation took", "%s: transforming %s took %s")
+	StrictRejected  = log.NewCode("DS1002", log.Lwarn, "a document with errors was rejected in strict mode", "%s rejected in strict mode")
+	WriteFailed     = log.NewCode("DS1003", log.Lerror, "the response could not be written", "failed to write %s: %v")
+	RequestFailed   = log.NewCode("DS1004", log.Lerror, "a request failed with a server error", "request %s %s failed with status %d: %v")
+	RequestPanicked = log.NewCode("DS1005", log.Lerror, "a request panicked", "request %s %s panicked: %v")
+	StackDump       = log.NewCode("DS1006", log.Lerror, "a line of the stack dump after a panic", "\t%s")
+	LogReopened     = log.NewCode("DS1007", log.Linfo, "the log file was reopened after SIGHUP", "reopened file %s")
+	LogReopenFailed = log.NewCode("DS1008", log.Lerror, "the log file could not be reopened after SIGHUP", "failed to reopen file %s: %v")
+	LevelsChanged   = log.NewCode("DS1009", log.Linfo, "the log levels were changed through the admin endpoint", "log levels changed by %s to %s %s")
+	LevelsReverted  = log.NewCode("DS1010", log.Linfo, "a temporary change of the log levels was reverted", "log levels reverted to %s %s")
+	AdminDenied     = log.NewCode("DS1011", log.Lwarn, "an admin request without a valid token was denied", "access to %s denied for %s")
+	LogDropped      = log.NewCode("DS1012", log.Lwarn, "log messages were dropped because the log queue was full", "%d log messages dropped")
+	ServerStopping  = log.NewCode("DS1013", log.Linfo, "the service received a signal to stop", "%s stopping on %s")
+	LogSuppressed   = log.NewCode("DS1014", log.Lwarn, "repeated log messages were suppressed by the rate limits", "%d messages of %s suppressed in the last %s")
+	ConfigReloaded  = log.NewCode("DS1015", log.Linfo, "the config was reloaded and swapped in", "config %s reloaded, changed %s")
+	ConfigRejected  = log.NewCode("DS1016", log.Lerror, "an invalid config was rejected on reload", "config %s rejected: %v")
+	ConfigRestart   = log.NewCode("DS1017", log.Lwarn, "changed settings only take effect after a restart", "changed settings %s take effect after a restart")
+)
+
+// These codes report on the transformation of documents.
+var (
+	InvalidJSON     = log.NewCode("DS1100", log.Lerror, "a data section is not valid JSON and was dropped", "invalid JSON in %s ignored: %s")
+	SchemaViolation = log.NewCode("DS1101", log.Lwarn, "a data section violates its schema", "%s violates its schema at %d locations")
+)
+
+// These codes report on the routine actions that modify the document body.
+var (
+	AttributesDisabled  = log.NewCode("DS1950", log.Linfo, "event attributes were disabled in the document body", "disabling %d %s events")
+	NoticePlaceholders  = log.NewCode("DS1951", log.Linfo, "notice placeholders were added to the document body", "adding %d notice placeholders")
+	SeeAlsoPlaceholders = log.NewCode("DS1952", log.Linfo, "see also placeholders were added to the document body", "adding %d seealso placeholders")
+)
+
+// These codes report on the link checker.
+var (
+	DuplicateDocID  = log.NewCode("DS1200", log.Lwarn, "the link checker found two documents with the same docid", "duplicate document %s in %s ignored")
+	LinkCheckUsage  = log.NewCode("DS1201", log.Lfatal, "the link checker was called with wrong arguments", "usage: docsan linkcheck <config file> <directory>")
+	LinkCheckLoad   = log.NewCode("DS1202", log.Lfatal, "the link checker could not load the documents", "failed to load documents from %s: %v")
+	LinkCheckReport = log.NewCode("DS1203", log.Lfatal, "the link checker could not write its report", "failed to write report: %v")
+)
+
+// These codes report on the config command.
+var (
+	ConfigUsage = log.NewCode("DS1300", log.Lfatal, "the config command was called with wrong arguments", "usage: docsan config print [config file]")
+	ConfigPrint = log.NewCode("DS1301", log.Lfatal, "the config command could not write the settings", "failed to print config: %v")
+)
@@ -1,14 +1,26 @@
 package config
 
 import (
-	"encoding/json"
 	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"ibfd.org/docsan/codes"
 	"ibfd.org/docsan/log4u"
+	"ibfd.org/docsan/schema"
 )
 
 // defaultPort defines the port to use if not defined
@@ -16,54 +28,418 @@ import (
 const defaultPort = "8080"
 const defaultConfigFilePath = "docsan.json"
 const defaultLogLevel = "DEBUG"
+const defaultCommand = "serve"
+const megabyte = 1 << 20
+const loggerName = "config"
+const defaultAppName = "docsan"
+const defaultWatchInterval = "2s"
+const outputQueueSize = 1000
 
-// LogDef defines logging configuration
+// commands defines the commands that may precede the positional arguments.
+// The config command is followed by a subcommand.
+var commands = map[string]bool{
+	"serve":     true,
+	"linkcheck": true,
+	"config":    true,
+}
+
+// LogDef defines logging configuration.
+// Format is text (the default) or json.
 type LogDef struct {
-	Filename string `json:"filename"`
-	Level    string `json:"level"`
+	Filename string            `json:"filename"`
+	Level    string            `json:"level"`
+	Format   string            `json:"format"`
+	Levels   string            `json:"levels"`
+	Codes    map[string]string `json:"codes"`
+	Rotation RotateDef         `json:"rotation"`
+	Async    AsyncDef          `json:"async"`
+	Outputs  []*OutputDef      `json:"outputs"`
+	Limits   LimitDef          `json:"limits"`
+	Payload  *int              `json:"max_payload"`
+}
+
+// LimitDef defines the rate limiting of repeated log messages. Per interval
+// the first burst messages with the same code or template are logged and
+// after that one in every sample messages. Keys sets other limits for
+// specific codes or templates. Rate limiting is off without an interval.
+type LimitDef struct {
+	Interval string               `json:"interval"`
+	Burst    int                  `json:"burst"`
+	Sample   int                  `json:"sample"`
+	Keys     map[string]*LimitKey `json:"keys"`
+}
+
+// LimitKey defines the rate limit of a specific code or template.
+type LimitKey struct {
+	Burst  int `json:"burst"`
+	Sample int `json:"sample"`
+}
+
+// OutputDef defines a log server that receives log messages in addition
+// to the log file. The type is syslog or gelf and the network udp or tcp.
+type OutputDef struct {
+	Type     string `json:"type"`
+	Network  string `json:"network"`
+	Address  string `json:"address"`
+	Facility string `json:"facility"`
+	AppName  string `json:"app_name"`
+}
+
+// These constants define the types of log outputs.
+const (
+	OutputSyslog = "syslog"
+	OutputGELF   = "gelf"
+)
+
+// AsyncDef defines the queue of the asynchronous log writer. The writer
+// is used if the queue size is positive. The overflow policy is block or drop.
+type AsyncDef struct {
+	QueueSize int    `json:"queue_size"`
+	Overflow  string `json:"overflow"`
+}
+
+// RotateDef defines when the log file is rotated and how many rotated files are kept.
+type RotateDef struct {
+	MaxSize  int64  `json:"max_size"`
+	MaxAge   string `json:"max_age"`
+	MaxFiles int    `json:"max_files"`
+	Compress bool   `json:"compress"`
+}
+
+// SchemaDef defines the JSON Schemas to validate document sections against.
+// Sections maps section names to schema file paths, which are relative
+// to the directory of the config file.
+type SchemaDef struct {
+	Policy   string            `json:"policy"`
+	Sections map[string]string `json:"sections"`
+}
+
+// These constants define what to do with sections that violate their schema.
+const (
+	SchemaPolicyFlag    = "flag"    // keep the section and report the violations
+	SchemaPolicyReplace = "replace" // replace the section by an empty value and report the violations
+)
+
+// MetaType defines how the values of a meta are normalized.
+// Formats are Go time layouts for dates, Base is the URL to resolve
+// relative URLs against, Values lists the allowed values of an enum
+// and Separator splits lists.
+type MetaType struct {
+	Type      string   `json:"type"`
+	Formats   []string `json:"formats,omitempty"`
+	Base      string   `json:"base,omitempty"`
+	Values    []string `json:"values,omitempty"`
+	Separator string   `json:"separator,omitempty"`
+}
+
+// These constants define the meta types.
+const (
+	MetaTypeDate = "date"
+	MetaTypeURL  = "url"
+	MetaTypeEnum = "enum"
+	MetaTypeList = "list"
+)
+
+// defaultDateFormats defines the date layouts to use if a date meta type has none.
+var defaultDateFormats = []string{"2006-01-02", "20060102", time.RFC3339}
+
+// DownloadRule defines how a meta maps to an alternative rendition of a document.
+// Relative URLs are resolved against Base, or against the base of the
+// meta type if the meta is typed as url.
+type DownloadRule struct {
+	Meta   string `json:"meta"`
+	Format string `json:"format"`
+	Scope  string `json:"scope"`
+	Base   string `json:"base,omitempty"`
+}
+
+// defaultDownloadRules defines the download rules to use if not defined in the config file.
+var defaultDownloadRules = []*DownloadRule{
+	{Meta: "pdf_chapter", Format: "pdf", Scope: "chapter"},
+	{Meta: "pdf_document", Format: "pdf", Scope: "document"},
+	{Meta: "pdf_article", Format: "pdf", Scope: "article"},
+	{Meta: "word_chapter", Format: "word", Scope: "chapter"},
+	{Meta: "print_version", Format: "print", Scope: "document"},
+	{Meta: "excel_version", Format: "excel", Scope: "document"},
+}
+
+// These constants define the kinds of sources a document id can be resolved from.
+// Sources are written as kind or kind:argument, e.g. meta:docid or header:X-DocID.
+const (
+	DocIDSourceMeta      = "meta"
+	DocIDSourceCanonical = "canonical"
+	DocIDSourceFilename  = "filename"
+	DocIDSourceHeader    = "header"
+	DocIDSourceQuery     = "query"
+	DocIDSourceHash      = "hash"
+)
+
+// defaultDocIDSources defines the document id resolution chain
+// to use if not defined in the config file.
+var defaultDocIDSources = []string{
+	"meta:docid",
+	"meta:global_lang-free-id",
+	"canonical",
+	"filename",
+	"header:X-DocID",
+	"query:docid",
+	"hash",
 }
 
 // Config defines the structure of the config.json file
 type Config struct {
-	Logging    LogDef   `json:"logging"`
-	JSONPretty bool     `json:"json_pretty"`
-	MetaTags   []string `json:"meta_tags"`
+	Logging       LogDef               `json:"logging"`
+	JSONPretty    bool                 `json:"json_pretty"`
+	MetaTags      []string             `json:"meta_tags"`
+	Schemas       SchemaDef            `json:"schemas"`
+	Strict        bool                 `json:"strict"`
+	Typed         bool                 `json:"typed_sections"`
+	DocIDChain    []string             `json:"docid_sources"`
+	DropMetas     bool                 `json:"drop_technical_metas"`
+	MetaTypes     map[string]*MetaType `json:"meta_types"`
+	Downloads     []*DownloadRule      `json:"downloads"`
+	DataExclude   []string             `json:"data_exclusions"`
+	Admin         AdminDef             `json:"admin"`
+	WatchInterval string               `json:"watch_interval"`
+}
+
+// AdminDef defines the access to the admin endpoints.
+type AdminDef struct {
+	Token string `json:"token"`
+}
+
+// Snapshot defines the configuration at one point in time. A snapshot is
+// not changed after it is swapped in; a reload swaps in a new snapshot,
+// so a request that holds on to one sees a consistent configuration.
+type Snapshot struct {
+	settings            []*Setting
+	logging             LogDef
+	codeLevels          map[string]log4u.LogLevel
+	limits              log4u.Limits
+	rotation            log4u.RotateOptions
+	overflow            log4u.OverflowPolicy
+	allowedMetaNames    *nameMatcher
+	excludedDataIslands *nameMatcher
+	dropTechnicalMetas  bool
+	metaTypes           map[string]*MetaType
+	downloadRules       []*DownloadRule
+	jsonPretty          bool
+	strict              bool
+	typedSections       bool
+	docIDSources        []string
+	schemas             map[string]*schema.Schema
+	schemaPolicy        string
+	adminToken          string
+	watchInterval       time.Duration
+}
+
+// restartSettings defines the settings that only take effect after a restart.
+var restartSettings = []string{
+	"logging.filename", "logging.rotation", "logging.async", "logging.outputs", "watch_interval",
 }
 
-var allowedMetaNames map[string]bool
+var current atomic.Value
+var reloadLock sync.Mutex
+var listeners []func(changed []string)
+var watchOnce sync.Once
 var configFilePath string
-var logFile *os.File
-var jsonPretty bool
+var configRequired bool
+var logFile *log4u.RotatingFile
+var logWriter *log4u.AsyncWriter
+var logOutputs []*log4u.AsyncOutput
+var command string
+var subcommand string
+var args []string
 
 func init() {
-	flag.Parse()
-	configFilePath = flag.Arg(0)
+	defineFlags()
+	snapshot, err := newSnapshot(defaultConfig(), nil)
+	if err != nil {
+		panic("config: invalid defaults: " + err.Error())
+	}
+	current.Store(snapshot)
+}
+
+// Init parses the command line, loads the config and sets up logging.
+// Until then the built-in defaults are in effect.
+func Init() {
+	parseArgs()
+	configFilePath = arg(0)
 	if configFilePath == "" {
 		configFilePath = defaultConfigFilePath
 	}
-	data, err := ioutil.ReadFile(configFilePath)
+	configRequired = arg(0) != ""
+	snapshot, err := load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	logFile, logWriter = configureLogging(snapshot)
+	logOutputs, err = snapshot.newOutputs()
 	if err != nil {
-		log.Fatalf("fail to read file %s: %v", configFilePath, err)
+		log.Fatal(err)
+	}
+	for _, output := range logOutputs {
+		log4u.AddOutput(output)
+	}
+	current.Store(snapshot)
+	reloadOnHangup()
+}
+
+// load loads the layers of the config and validates the result.
+func load() (*Snapshot, error) {
+	config, settings, err := loadConfig(configRequired)
+	if err != nil {
+		return nil, err
+	}
+	return newSnapshot(config, settings)
+}
+
+// newSnapshot validates a config and prepares it for use.
+func newSnapshot(config *Config, settings []*Setting) (*Snapshot, error) {
+	s := &Snapshot{
+		settings:           settings,
+		logging:            config.Logging,
+		jsonPretty:         config.JSONPretty,
+		strict:             config.Strict,
+		typedSections:      config.Typed,
+		dropTechnicalMetas: config.DropMetas,
+		adminToken:         config.Admin.Token}
+	var err error
+	if err = s.checkLogging(&config.Logging); err != nil {
+		return nil, err
+	}
+	if s.allowedMetaNames, err = s.compileNames(config.MetaTags, "meta tag", "meta_tags"); err != nil {
+		return nil, err
+	}
+	if s.excludedDataIslands, err = s.compileNames(config.DataExclude, "data island", "data_exclusions"); err != nil {
+		return nil, err
+	}
+	if s.metaTypes, err = s.configureMetaTypes(config.MetaTypes); err != nil {
+		return nil, err
+	}
+	if s.downloadRules, err = s.configureDownloads(config.Downloads); err != nil {
+		return nil, err
+	}
+	if s.schemas, s.schemaPolicy, err = s.configureSchemas(&config.Schemas); err != nil {
+		return nil, err
 	}
-	var config Config
-	err = json.Unmarshal(data, &config)
+	if s.docIDSources, err = s.configureDocIDSources(config.DocIDChain); err != nil {
+		return nil, err
+	}
+	if config.WatchInterval != "" {
+		s.watchInterval, err = time.ParseDuration(config.WatchInterval)
+		if err != nil || s.watchInterval < 0 {
+			return nil, fmt.Errorf("invalid watch interval %s in %s", config.WatchInterval, s.origin("watch_interval"))
+		}
+	}
+	return s, nil
+}
+
+// Current returns the configuration that is in effect.
+func Current() *Snapshot {
+	return current.Load().(*Snapshot)
+}
+
+// Reload loads the config again and swaps it in if it is valid and
+// changed. An invalid config is logged and rejected; the current
+// configuration then stays in effect. Settings that only take effect
+// after a restart are reported.
+func Reload() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	logger := log4u.Named(loggerName)
+	snapshot, err := load()
 	if err != nil {
-		log.Fatalf("fail to unmarshal from file %s: %v", configFilePath, err)
+		logger.Log(codes.ConfigRejected, configFilePath, err)
+		return err
+	}
+	changed := changedSettings(Current(), snapshot)
+	if len(changed) == 0 {
+		return nil
 	}
-	logFile = configureLogging(&config.Logging)
-	jsonPretty = config.JSONPretty
-	allowedMetaNames = make(map[string]bool, len(config.MetaTags))
-	for _, metaName := range config.MetaTags {
-		allowedMetaNames[metaName] = true
+	var restart []string
+	for _, path := range changed {
+		if matchesSetting(path, restartSettings) {
+			restart = append(restart, path)
+		}
+	}
+	if LoggingChanged(changed) {
+		snapshot.applyLogging()
+	}
+	current.Store(snapshot)
+	logger.Log(codes.ConfigReloaded, configFilePath, strings.Join(changed, ", "))
+	if len(restart) > 0 {
+		logger.Log(codes.ConfigRestart, strings.Join(restart, ", "))
+	}
+	for _, listener := range listeners {
+		listener(changed)
+	}
+	return nil
+}
+
+// LoggingChanged checks whether a reload with the changed settings
+// applied the logging settings again, which resets the log levels.
+func LoggingChanged(changed []string) bool {
+	for _, path := range changed {
+		if strings.HasPrefix(path, "logging.") && !matchesSetting(path, restartSettings) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSetting checks whether a setting is one of the paths or in one of their sections.
+func matchesSetting(path string, paths []string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch registers a listener that is called with the changed settings
+// after every configuration that is swapped in. The first call starts
+// polling the config file for changes at the configured watch interval.
+// A zero interval disables polling; the config can then still be
+// reloaded with SIGHUP.
+func Watch(listener func(changed []string)) {
+	reloadLock.Lock()
+	listeners = append(listeners, listener)
+	reloadLock.Unlock()
+	watchOnce.Do(func() {
+		if interval := Current().watchInterval; interval > 0 {
+			go watchFile(interval)
+		}
+	})
+}
+
+// watchFile reloads the config when the modification time or the size
+// of the config file changes.
+func watchFile(interval time.Duration) {
+	last := fileStamp()
+	for range time.Tick(interval) {
+		if stamp := fileStamp(); stamp != last {
+			last = stamp
+			Reload()
+		}
+	}
+}
+
+// fileStamp identifies the version of the config file.
+func fileStamp() string {
+	info, err := os.Stat(configFilePath)
+	if err != nil {
+		return ""
 	}
+	return fmt.Sprintf("%d %d", info.ModTime().UnixNano(), info.Size())
 }
 
 // GetPort returns the port to use for the Docsan service
 func GetPort() string {
 	port := os.Getenv("PORT")
 	if port == "" {
-		flag.Parse()
-		port = flag.Arg(1)
+		port = arg(1)
 		if port == "" {
 			port = defaultPort
 		}
@@ -71,37 +447,506 @@ func GetPort() string {
 	return port
 }
 
+// Command returns the command to execute.
+func Command() string {
+	return command
+}
+
+// CommandArgs returns the positional arguments that follow the config file path.
+func CommandArgs() []string {
+	if len(args) < 2 {
+		return nil
+	}
+	return args[1:]
+}
+
+// Subcommand returns the subcommand of the config command.
+func Subcommand() string {
+	return subcommand
+}
+
+// parseArgs splits the command line into an optional command
+// followed by positional arguments.
+func parseArgs() {
+	flag.Parse()
+	command = defaultCommand
+	args = flag.Args()
+	if len(args) > 0 && commands[args[0]] {
+		command = args[0]
+		args = args[1:]
+		if command == "config" && len(args) > 0 {
+			subcommand = args[0]
+			args = args[1:]
+		}
+	}
+}
+
+func arg(i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
 // CloseLog closes the log file.
+// Queued log messages are written first.
 func CloseLog() {
+	logDropped()
+	if logWriter != nil {
+		logWriter.Close()
+	}
+	for _, output := range logOutputs {
+		output.Close()
+	}
 	logFile.Close()
 }
 
-func configureLogging(logConfig *LogDef) *os.File {
-	var logFile *os.File
+// logDropped logs the number of log messages dropped by the queues
+// while they still accept messages. The queues are written first to
+// make room for the message.
+func logDropped() {
+	if logWriter != nil {
+		logWriter.Flush()
+	}
+	for _, output := range logOutputs {
+		output.Flush()
+	}
+	if logWriter != nil {
+		if dropped := logWriter.Dropped(); dropped > 0 {
+			log4u.Named(loggerName).Log(codes.LogDropped, dropped)
+		}
+	}
+	for _, output := range logOutputs {
+		if dropped := output.Dropped(); dropped > 0 {
+			log4u.Named(loggerName).Log(codes.LogDropped, dropped)
+		}
+	}
+}
+
+// LogWriter returns the asynchronous log writer, or nil if logging is synchronous.
+func LogWriter() *log4u.AsyncWriter {
+	return logWriter
+}
+
+// configureLogging opens the log file and sets up the standard logger.
+func configureLogging(s *Snapshot) (*log4u.RotatingFile, *log4u.AsyncWriter) {
+	var logFile *log4u.RotatingFile
+	var logWriter *log4u.AsyncWriter
 	var err error
-	if logConfig == nil || logConfig.Filename == "" {
+	var logger io.Writer = os.Stderr
+	if s.logging.Filename != "" {
+		logFile, err = log4u.OpenRotatingFile(s.logging.Filename, s.rotation)
+		if err != nil {
+			log.Fatalf("failed to open file %s: %v", s.logging.Filename, err)
+		}
+		logger = io.MultiWriter(os.Stderr, logFile)
+	}
+	if s.logging.Async.QueueSize > 0 {
+		logWriter = log4u.NewAsyncWriter(logger, s.logging.Async.QueueSize, s.overflow)
+		logger = logWriter
+	}
+	log4u.SetOutput(logger)
+	s.applyLogging()
+	return logFile, logWriter
+}
+
+// applyLogging applies the logging settings that can change at runtime.
+func (s *Snapshot) applyLogging() {
+	if s.logging.Filename == "" {
 		log4u.SetLevel(defaultLogLevel)
 	} else {
-		logFile, err = os.Create(logConfig.Filename)
+		log4u.SetLevel(s.logging.Level)
+	}
+	if s.logging.Format != "" {
+		log4u.SetFormat(s.logging.Format)
+	}
+	log4u.SetLevels(s.logging.Levels)
+	log4u.SetCodeLevels(s.codeLevels)
+	log4u.SetLimits(s.limits)
+	maxPayload := log4u.DefaultMaxPayload
+	if s.logging.Payload != nil {
+		maxPayload = *s.logging.Payload
+	}
+	log4u.SetMaxPayload(maxPayload)
+}
+
+// checkLogging validates the logging settings.
+func (s *Snapshot) checkLogging(logConfig *LogDef) error {
+	var err error
+	if logConfig.Filename != "" && !log4u.ValidLevel(logConfig.Level) {
+		return fmt.Errorf("invalid log level %s in %s", logConfig.Level, s.origin("logging.level"))
+	}
+	if logConfig.Format != "" && logConfig.Format != "text" && logConfig.Format != "json" {
+		return fmt.Errorf("invalid log format %s in %s", logConfig.Format, s.origin("logging.format"))
+	}
+	if _, err = log4u.ParseLevels(logConfig.Levels); err != nil {
+		return fmt.Errorf("invalid levels %s in %s: %v", logConfig.Levels, s.origin("logging.levels"), err)
+	}
+	if s.codeLevels, err = log4u.ParseCodeLevels(logConfig.Codes); err != nil {
+		return fmt.Errorf("invalid level override in %s: %v", s.origin("logging.codes"), err)
+	}
+	s.overflow = log4u.OverflowBlock
+	if logConfig.Async.Overflow != "" {
+		if s.overflow, err = log4u.ParseOverflowPolicy(logConfig.Async.Overflow); err != nil {
+			return fmt.Errorf("invalid log overflow policy %s in %s", logConfig.Async.Overflow, s.origin("logging.async.overflow"))
+		}
+	}
+	if s.limits, err = s.configureLimits(&logConfig.Limits); err != nil {
+		return err
+	}
+	if s.rotation, err = s.rotateOptions(&logConfig.Rotation); err != nil {
+		return err
+	}
+	return s.checkOutputs(logConfig.Outputs)
+}
+
+// checkOutputs validates the log outputs without connecting to them.
+func (s *Snapshot) checkOutputs(outputDefs []*OutputDef) error {
+	for _, outputDef := range outputDefs {
+		if outputDef == nil || outputDef.Address == "" {
+			return fmt.Errorf("log output without address in %s", s.origin("logging.outputs"))
+		}
+		if outputDef.Type != OutputSyslog && outputDef.Type != OutputGELF {
+			return fmt.Errorf("invalid log output type %s in %s", outputDef.Type, s.origin("logging.outputs"))
+		}
+		if outputDef.Network != "" && !log4u.ValidNetwork(outputDef.Network) {
+			return fmt.Errorf("invalid %s log output network %s in %s", outputDef.Type, outputDef.Network, s.origin("logging.outputs"))
+		}
+		if _, _, err := net.SplitHostPort(outputDef.Address); err != nil {
+			return fmt.Errorf("invalid %s log output address %s in %s", outputDef.Type, outputDef.Address, s.origin("logging.outputs"))
+		}
+		if outputDef.Type == OutputSyslog && !log4u.ValidFacility(outputDef.Facility) {
+			return fmt.Errorf("invalid syslog facility %s in %s", outputDef.Facility, s.origin("logging.outputs"))
+		}
+	}
+	return nil
+}
+
+// newOutputs creates the log outputs, which checkOutputs validated.
+// Each output has its own queue, so a slow or unreachable log server
+// never holds up logging.
+func (s *Snapshot) newOutputs() ([]*log4u.AsyncOutput, error) {
+	outputs := make([]*log4u.AsyncOutput, 0, len(s.logging.Outputs))
+	for _, outputDef := range s.logging.Outputs {
+		network := outputDef.Network
+		if network == "" {
+			network = "udp"
+		}
+		var output log4u.EntryWriter
+		var err error
+		switch outputDef.Type {
+		case OutputSyslog:
+			appName := outputDef.AppName
+			if appName == "" {
+				appName = defaultAppName
+			}
+			output, err = log4u.NewSyslogOutput(network, outputDef.Address, outputDef.Facility, appName)
+		case OutputGELF:
+			output, err = log4u.NewGELFOutput(network, outputDef.Address)
+		default:
+			return nil, fmt.Errorf("invalid log output type %s in %s", outputDef.Type, s.origin("logging.outputs"))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s log output in %s: %v", outputDef.Type, s.origin("logging.outputs"), err)
+		}
+		outputs = append(outputs, log4u.NewAsyncOutput(output, outputQueueSize))
+	}
+	return outputs, nil
+}
+
+// configureLimits converts the rate limits of repeated log messages.
+func (s *Snapshot) configureLimits(limitConfig *LimitDef) (log4u.Limits, error) {
+	if limitConfig.Interval == "" {
+		return log4u.Limits{}, nil
+	}
+	interval, err := time.ParseDuration(limitConfig.Interval)
+	if err != nil || interval <= 0 {
+		return log4u.Limits{}, fmt.Errorf("invalid log limit interval %s in %s", limitConfig.Interval, s.origin("logging.limits.interval"))
+	}
+	limits := log4u.Limits{
+		Interval: interval,
+		Default:  log4u.Limit{Burst: limitConfig.Burst, Sample: limitConfig.Sample},
+		Keys:     make(map[string]log4u.Limit, len(limitConfig.Keys)),
+		Summary:  codes.LogSuppressed}
+	if limitConfig.Burst < 0 || limitConfig.Sample < 0 {
+		return log4u.Limits{}, fmt.Errorf("invalid log limit in %s", s.origin("logging.limits"))
+	}
+	if limitConfig.Burst == 0 && limitConfig.Sample == 0 {
+		return log4u.Limits{}, fmt.Errorf("log limit without burst or sample suppresses every message in %s", s.origin("logging.limits"))
+	}
+	for key, limit := range limitConfig.Keys {
+		if limit == nil || limit.Burst < 0 || limit.Sample < 0 {
+			return log4u.Limits{}, fmt.Errorf("invalid log limit for %s in %s", key, s.origin("logging.limits.keys"))
+		}
+		if limit.Burst == 0 && limit.Sample == 0 {
+			return log4u.Limits{}, fmt.Errorf("log limit for %s without burst or sample suppresses every message in %s", key, s.origin("logging.limits.keys"))
+		}
+		limits.Keys[key] = log4u.Limit{Burst: limit.Burst, Sample: limit.Sample}
+	}
+	return limits, nil
+}
+
+// rotateOptions converts the rotation settings of the log file.
+// The maximum size is given in megabytes.
+func (s *Snapshot) rotateOptions(rotateConfig *RotateDef) (log4u.RotateOptions, error) {
+	options := log4u.RotateOptions{
+		MaxSize:  rotateConfig.MaxSize * megabyte,
+		MaxFiles: rotateConfig.MaxFiles,
+		Compress: rotateConfig.Compress}
+	if rotateConfig.MaxAge != "" {
+		maxAge, err := time.ParseDuration(rotateConfig.MaxAge)
+		if err != nil || maxAge < 0 {
+			return options, fmt.Errorf("invalid log rotation age %s in %s", rotateConfig.MaxAge, s.origin("logging.rotation.max_age"))
+		}
+		options.MaxAge = maxAge
+	}
+	if options.MaxSize < 0 || options.MaxFiles < 0 {
+		return options, fmt.Errorf("invalid log rotation size or file count in %s", s.origin("logging.rotation"))
+	}
+	return options, nil
+}
+
+// reloadOnHangup reopens the log file, so it can also be rotated by
+// external tools, and reloads the config when the process receives SIGHUP.
+func reloadOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if logFile != nil {
+				if err := logFile.Reopen(); err != nil {
+					log4u.Named(loggerName).Log(codes.LogReopenFailed, logFile.Filename(), err)
+				} else {
+					log4u.Named(loggerName).Log(codes.LogReopened, logFile.Filename())
+				}
+			}
+			Reload()
+		}
+	}()
+}
+
+func (s *Snapshot) configureSchemas(schemaConfig *SchemaDef) (map[string]*schema.Schema, string, error) {
+	policy := schemaConfig.Policy
+	if policy == "" {
+		policy = SchemaPolicyFlag
+	}
+	if policy != SchemaPolicyFlag && policy != SchemaPolicyReplace {
+		return nil, "", fmt.Errorf("invalid schema policy %s in %s", policy, s.origin("schemas.policy"))
+	}
+	compiled := make(map[string]*schema.Schema, len(schemaConfig.Sections))
+	for section, filename := range schemaConfig.Sections {
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(filepath.Dir(configFilePath), filename)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, "", fmt.Errorf("fail to read schema file %s: %v", filename, err)
+		}
+		compiled[section], err = schema.Parse(data)
 		if err != nil {
-			log.Fatalf("failed to create file %s: %v", logConfig.Filename, err)
+			return nil, "", fmt.Errorf("fail to parse schema file %s: %v", filename, err)
+		}
+	}
+	return compiled, policy, nil
+}
+
+// nameMatcher matches names against exact names and patterns.
+type nameMatcher struct {
+	names    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// compileNames splits a list of names into exact names and patterns.
+// A name between slashes, like /^og:/, is a regular expression; a name
+// with wildcards, like dc.*, is a glob pattern.
+func (s *Snapshot) compileNames(list []string, what string, setting string) (*nameMatcher, error) {
+	matcher := &nameMatcher{names: make(map[string]bool, len(list))}
+	for _, name := range list {
+		var expr string
+		switch {
+		case len(name) > 2 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/"):
+			expr = name[1 : len(name)-1]
+		case strings.ContainsAny(name, "*?"):
+			expr = globToRegexp(name)
+		default:
+			matcher.names[name] = true
+			continue
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %s in %s: %v", what, name, s.origin(setting), err)
+		}
+		matcher.patterns = append(matcher.patterns, pattern)
+	}
+	return matcher, nil
+}
+
+// match checks whether a name is one of the exact names or matches one of the patterns.
+func (matcher *nameMatcher) match(name string) bool {
+	if matcher.names[name] {
+		return true
+	}
+	for _, pattern := range matcher.patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// globToRegexp converts a glob pattern with * and ? wildcards to a regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteByte('^')
+	for _, c := range glob {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteByte('.')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteByte('$')
+	return b.String()
+}
+
+func (s *Snapshot) configureMetaTypes(types map[string]*MetaType) (map[string]*MetaType, error) {
+	for name, metaType := range types {
+		if metaType == nil {
+			return nil, fmt.Errorf("meta type %s: missing definition in %s", name, s.origin("meta_types"))
+		}
+		switch metaType.Type {
+		case MetaTypeDate:
+			if len(metaType.Formats) == 0 {
+				metaType.Formats = defaultDateFormats
+			}
+		case MetaTypeURL:
+			if metaType.Base != "" {
+				if base, err := url.Parse(metaType.Base); err != nil || !base.IsAbs() {
+					return nil, fmt.Errorf("invalid base URL %s for meta %s in %s", metaType.Base, name, s.origin("meta_types"))
+				}
+			}
+		case MetaTypeEnum:
+		case MetaTypeList:
+			if metaType.Separator == "" {
+				metaType.Separator = ","
+			}
+		default:
+			return nil, fmt.Errorf("invalid type %s for meta %s in %s", metaType.Type, name, s.origin("meta_types"))
+		}
+	}
+	return types, nil
+}
+
+func (s *Snapshot) configureDownloads(rules []*DownloadRule) ([]*DownloadRule, error) {
+	if len(rules) == 0 {
+		return defaultDownloadRules, nil
+	}
+	for _, rule := range rules {
+		if rule == nil || rule.Meta == "" || rule.Format == "" {
+			return nil, fmt.Errorf("download rule without meta or format in %s", s.origin("downloads"))
+		}
+		if rule.Base != "" {
+			if base, err := url.Parse(rule.Base); err != nil || !base.IsAbs() {
+				return nil, fmt.Errorf("invalid base URL %s for download %s in %s", rule.Base, rule.Meta, s.origin("downloads"))
+			}
 		}
-		logger := io.MultiWriter(os.Stderr, logFile)
-		log4u.SetLevel(logConfig.Level)
-		log4u.SetOutput(logger)
 	}
-	return logFile
+	return rules, nil
+}
+
+func (s *Snapshot) configureDocIDSources(sources []string) ([]string, error) {
+	if len(sources) == 0 {
+		return defaultDocIDSources, nil
+	}
+	for _, source := range sources {
+		kind, arg := SplitDocIDSource(source)
+		switch kind {
+		case DocIDSourceMeta, DocIDSourceHeader, DocIDSourceQuery:
+			if arg == "" {
+				return nil, fmt.Errorf("docid source %s in %s needs an argument", source, s.origin("docid_sources"))
+			}
+		case DocIDSourceCanonical, DocIDSourceFilename, DocIDSourceHash:
+		default:
+			return nil, fmt.Errorf("invalid docid source %s in %s", source, s.origin("docid_sources"))
+		}
+	}
+	return sources, nil
+}
+
+// AdminToken returns the bearer token that grants access to the admin
+// endpoints. The admin endpoints are disabled without a token.
+func (s *Snapshot) AdminToken() string {
+	return s.adminToken
 }
 
 // JSONPretty indicates whether JSON output should be formatted nicely.
-func JSONPretty() bool {
-	return jsonPretty
+func (s *Snapshot) JSONPretty() bool {
+	return s.jsonPretty
 }
 
-// MetaNameAccept returns a function to filter meta tags
-func MetaNameAccept() func(string) bool {
-	return func(metaName string) bool {
-		_, present := allowedMetaNames[metaName]
-		return present
+// Strict indicates whether documents with error diagnostics must be
+// rejected instead of returned with degraded output.
+func (s *Snapshot) Strict() bool {
+	return s.strict
+}
+
+// TypedSections indicates whether the data sections of documents must be
+// decoded into their Go models, normalized and encoded again.
+func (s *Snapshot) TypedSections() bool {
+	return s.typedSections
+}
+
+// DocIDSources returns the sources to resolve document ids from, in order.
+func (s *Snapshot) DocIDSources() []string {
+	return s.docIDSources
+}
+
+// SplitDocIDSource splits a document id source into its kind and argument.
+func SplitDocIDSource(source string) (string, string) {
+	parts := strings.SplitN(source, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
 	}
+	return parts[0], parts[1]
+}
+
+// Schemas returns the JSON Schemas to validate document sections against,
+// keyed by section name.
+func (s *Snapshot) Schemas() map[string]*schema.Schema {
+	return s.schemas
+}
+
+// SchemaPolicy returns what to do with sections that violate their schema.
+func (s *Snapshot) SchemaPolicy() string {
+	return s.schemaPolicy
+}
+
+// DropTechnicalMetas indicates whether metas without a name, such as
+// charset and http-equiv metas, must be dropped.
+func (s *Snapshot) DropTechnicalMetas() bool {
+	return s.dropTechnicalMetas
+}
+
+// MetaTypes returns the types of metas to normalize, keyed by meta name.
+func (s *Snapshot) MetaTypes() map[string]*MetaType {
+	return s.metaTypes
+}
+
+// DownloadRules returns the rules to build the downloads section from metas.
+func (s *Snapshot) DownloadRules() []*DownloadRule {
+	return s.downloadRules
+}
+
+// MetaNameAccept returns a function to filter meta tags
+func (s *Snapshot) MetaNameAccept() func(string) bool {
+	return s.allowedMetaNames.match
+}
+
+// DataIslandExclude returns a function to select the ids of
+// JSON data islands that must not be extracted.
+func (s *Snapshot) DataIslandExclude() func(string) bool {
+	return s.excludedDataIslands.match
 }
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"ibfd.org/docsan/log4u"
+)
+
+// useConfigFile writes a config file and loads it as the current config.
+func useConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "docsan.json")
+	writeConfigFile(t, path, content)
+	previousPath, previousRequired, previous := configFilePath, configRequired, Current()
+	configFilePath, configRequired = path, true
+	t.Cleanup(func() {
+		configFilePath, configRequired = previousPath, previousRequired
+		current.Store(previous)
+	})
+	snapshot, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Store(snapshot)
+	return path
+}
+
+func writeConfigFile(t *testing.T, path string, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadSwapsInChangedConfig(t *testing.T) {
+	path := useConfigFile(t, `{"json_pretty": false, "watch_interval": "0"}`)
+	var notified []string
+	reloadLock.Lock()
+	previousListeners := listeners
+	listeners = []func(changed []string){func(changed []string) { notified = changed }}
+	reloadLock.Unlock()
+	defer func() { listeners = previousListeners }()
+	before := Current()
+	writeConfigFile(t, path, `{"json_pretty": true, "strict": true, "watch_interval": "0"}`)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if Current() == before || !Current().JSONPretty() || !Current().Strict() {
+		t.Error("changed config not swapped in")
+	}
+	if before.JSONPretty() || before.Strict() {
+		t.Error("previous snapshot changed by the reload")
+	}
+	if want := []string{"json_pretty", "strict"}; !reflect.DeepEqual(notified, want) {
+		t.Errorf("listeners notified of %v, want %v", notified, want)
+	}
+}
+
+func TestReloadIgnoresUnchangedConfig(t *testing.T) {
+	path := useConfigFile(t, `{"json_pretty": true, "watch_interval": "0"}`)
+	before := Current()
+	writeConfigFile(t, path, `{"watch_interval": "0", "json_pretty": true}`)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if Current() != before {
+		t.Error("unchanged config swapped in")
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{"syntax", `{"json_pretty": `, "fail to unmarshal"},
+		{"meta type without definition", `{"meta_types": {"isbn": null}}`, "meta type isbn: missing definition"},
+		{"meta type base", `{"meta_types": {"src": {"type": "url", "base": "relative/path"}}}`, "invalid base URL"},
+		{"unparsable meta type base", `{"meta_types": {"src": {"type": "url", "base": "http://[::1"}}}`, "invalid base URL"},
+		{"docid source", `{"docid_sources": ["meta"]}`, "needs an argument"},
+		{"limit", `{"logging": {"limits": {"interval": "1m"}}}`, "suppresses every message"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := useConfigFile(t, `{"json_pretty": true, "watch_interval": "0"}`)
+			before := Current()
+			writeConfigFile(t, path, test.content)
+			err := Reload()
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("reload failed with %v, want %q", err, test.message)
+			}
+			if err != nil && !strings.Contains(err.Error(), path) {
+				t.Errorf("error %v does not name the config file", err)
+			}
+			if Current() != before {
+				t.Error("invalid config swapped in")
+			}
+		})
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	useConfigFile(t, `{"strict": true, "meta_tags": ["a", "b"], "logging": {"level": "INFO"}}`)
+	previous := Current()
+	useConfigFile(t, `{"strict": true, "meta_tags": ["a", "c"], "logging": {"level": "WARN", "filename": "docsan.log"}}`)
+	changed := changedSettings(previous, Current())
+	want := []string{"logging.filename", "logging.level", "meta_tags"}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed settings are %v, want %v", changed, want)
+	}
+	if !LoggingChanged(changed) {
+		t.Error("logging level change does not apply the logging settings")
+	}
+	if LoggingChanged([]string{"logging.filename", "logging.rotation.max_size", "strict"}) {
+		t.Error("restart-only settings apply the logging settings")
+	}
+}
+
+func TestSchemaPathsAreRelativeToTheConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, filepath.Join(dir, "outline.json"), `{"type": "object"}`)
+	previousPath := configFilePath
+	configFilePath = filepath.Join(dir, "docsan.json")
+	defer func() { configFilePath = previousPath }()
+	writeConfigFile(t, configFilePath, `{"schemas": {"sections": {"outline": "outline.json"}}}`)
+	snapshot, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Schemas()["outline"] == nil {
+		t.Error("outline schema not loaded")
+	}
+}
+
+// gatedWriter holds back writes until it is released.
+type gatedWriter struct {
+	started chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func TestCloseLogWritesTheDroppedCount(t *testing.T) {
+	out := &gatedWriter{started: make(chan struct{}, 1), release: make(chan struct{})}
+	previousWriter := logWriter
+	logWriter = log4u.NewAsyncWriter(out, 1, log4u.OverflowDrop)
+	log4u.SetOutput(logWriter)
+	defer func() {
+		log4u.SetOutput(os.Stderr)
+		logWriter = previousWriter
+	}()
+	logWriter.Write([]byte("written\n"))
+	<-out.started
+	logWriter.Write([]byte("queued\n"))
+	if _, err := logWriter.Write([]byte("dropped\n")); err == nil {
+		t.Fatal("message not dropped")
+	}
+	close(out.release)
+	CloseLog()
+	if written := out.buf.String(); !strings.Contains(written, "DS1012") || !strings.Contains(written, "1 log messages dropped") {
+		t.Errorf("dropped count not written: %q", written)
+	}
+}
+
+// gatedOutput holds back entries until it is released.
+type gatedOutput struct {
+	started  chan struct{}
+	release  chan struct{}
+	mu       sync.Mutex
+	messages []string
+}
+
+func (o *gatedOutput) WriteEntry(entry *log4u.Entry) error {
+	select {
+	case o.started <- struct{}{}:
+	default:
+	}
+	<-o.release
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, entry.Message)
+	return nil
+}
+
+func (o *gatedOutput) Close() error {
+	return nil
+}
+
+func TestCloseLogSendsTheDroppedCountToOutputs(t *testing.T) {
+	out := &gatedOutput{started: make(chan struct{}, 1), release: make(chan struct{})}
+	output := log4u.NewAsyncOutput(out, 1)
+	previousWriter, previousOutputs := logWriter, logOutputs
+	logWriter, logOutputs = nil, []*log4u.AsyncOutput{output}
+	log4u.SetOutput(ioutil.Discard)
+	log4u.AddOutput(output)
+	defer func() {
+		log4u.SetOutput(os.Stderr)
+		logWriter, logOutputs = previousWriter, previousOutputs
+	}()
+	entry := &log4u.Entry{Message: "entry\n"}
+	output.WriteEntry(entry)
+	<-out.started
+	output.WriteEntry(entry)
+	if err := output.WriteEntry(entry); err == nil {
+		t.Fatal("entry not dropped")
+	}
+	close(out.release)
+	CloseLog()
+	if messages := strings.Join(out.messages, ""); !strings.Contains(messages, "1 log messages dropped") {
+		t.Errorf("dropped count not sent: %q", messages)
+	}
+}
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// envPrefix defines the prefix of the environment variables that override settings.
+const envPrefix = "DOCSAN_"
+
+// These constants define the layers a setting can come from, in order of precedence.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// secretSettings defines the settings whose values are not printed.
+var secretSettings = map[string]bool{"admin.token": true}
+
+// Setting defines the effective value of a setting and where it came from.
+type Setting struct {
+	Path   string
+	Value  interface{}
+	Source string
+	Origin string // the file, environment variable or flag that set the value
+}
+
+// leaf defines a setting that is not a nested section of the config.
+type leaf struct {
+	path string
+	typ  reflect.Type
+}
+
+// flagValue collects a setting from the command line.
+type flagValue struct {
+	leaf  *leaf
+	value string
+	set   bool
+}
+
+var settingFlags []*flagValue
+
+// defaultConfig defines the built-in defaults of the config.
+func defaultConfig() *Config {
+	return &Config{
+		Logging:       LogDef{Level: defaultLogLevel, Format: "text"},
+		Schemas:       SchemaDef{Policy: SchemaPolicyFlag},
+		DocIDChain:    defaultDocIDSources,
+		Downloads:     defaultDownloadRules,
+		WatchInterval: defaultWatchInterval}
+}
+
+// defineFlags defines a flag for every setting, named by its path such
+// as -logging.level, before the command line is parsed.
+func defineFlags() {
+	for _, l := range configLeaves(reflect.TypeOf(Config{}), "") {
+		value := &flagValue{leaf: l}
+		flag.Var(value, l.path, fmt.Sprintf("overrides %s in the config file", l.path))
+		settingFlags = append(settingFlags, value)
+	}
+}
+
+// loadConfig merges the layers of the config: the built-in defaults,
+// the config file, DOCSAN_* environment variables and flags. The
+// config file is optional if its path was not given.
+func loadConfig(required bool) (*Config, []*Setting, error) {
+	leaves := configLeaves(reflect.TypeOf(Config{}), "")
+	merged := make(map[string]interface{})
+	settings := make([]*Setting, 0, len(leaves))
+	defaults := toMap(defaultConfig())
+	file := make(map[string]interface{})
+	data, err := ioutil.ReadFile(configFilePath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, nil, fmt.Errorf("fail to unmarshal from file %s: %v", configFilePath, err)
+		}
+	case required || !os.IsNotExist(err):
+		return nil, nil, fmt.Errorf("fail to read file %s: %v", configFilePath, err)
+	}
+	flags := make(map[string]*flagValue, len(settingFlags))
+	for _, f := range settingFlags {
+		flags[f.leaf.path] = f
+	}
+	for _, l := range leaves {
+		setting := &Setting{Path: l.path, Source: SourceDefault}
+		setting.Value, _ = lookup(defaults, l.path)
+		if value, present := lookup(file, l.path); present {
+			setting.Value, setting.Source, setting.Origin = value, SourceFile, configFilePath
+		}
+		name := envName(l.path)
+		if raw, present := os.LookupEnv(name); present {
+			if setting.Value, err = l.parse(raw, name); err != nil {
+				return nil, nil, err
+			}
+			setting.Source, setting.Origin = SourceEnv, name
+		}
+		if f := flags[l.path]; f != nil && f.set {
+			if setting.Value, err = l.parse(f.value, "-"+l.path); err != nil {
+				return nil, nil, err
+			}
+			setting.Source, setting.Origin = SourceFlag, "-"+l.path
+		}
+		put(merged, l.path, setting.Value)
+		settings = append(settings, setting)
+	}
+	data, err = json.Marshal(merged)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fail to merge config: %v", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %v", err)
+	}
+	return &config, settings, nil
+}
+
+// origin describes where a setting, or the first overridden setting
+// of a section, came from for error messages.
+func (s *Snapshot) origin(path string) string {
+	var found *Setting
+	for _, setting := range s.settings {
+		if setting.Path != path && !strings.HasPrefix(setting.Path, path+".") {
+			continue
+		}
+		if found == nil || (found.Source == SourceDefault && setting.Source != SourceDefault) {
+			found = setting
+		}
+	}
+	if found == nil {
+		return "file " + configFilePath
+	}
+	switch found.Source {
+	case SourceDefault:
+		return "the defaults"
+	case SourceEnv:
+		return "environment variable " + found.Origin
+	case SourceFlag:
+		return "flag " + found.Origin
+	default:
+		return "file " + found.Origin
+	}
+}
+
+// changedSettings lists the paths of the settings whose values differ
+// between two snapshots.
+func changedSettings(previous *Snapshot, next *Snapshot) []string {
+	values := make(map[string]interface{}, len(previous.settings))
+	for _, setting := range previous.settings {
+		values[setting.Path] = setting.Value
+	}
+	var changed []string
+	for _, setting := range next.settings {
+		if !reflect.DeepEqual(values[setting.Path], setting.Value) {
+			changed = append(changed, setting.Path)
+		}
+	}
+	return changed
+}
+
+// Settings returns the effective settings and where they came from.
+func (s *Snapshot) Settings() []*Setting {
+	return s.settings
+}
+
+// Settings returns the effective settings of the current config.
+func Settings() []*Setting {
+	return Current().Settings()
+}
+
+// PrintSettings writes the effective settings, one per line, with
+// their JSON value and where they came from. Secrets are masked.
+func PrintSettings(w io.Writer) error {
+	for _, setting := range Settings() {
+		value, err := json.Marshal(setting.Value)
+		if err != nil {
+			return err
+		}
+		if secretSettings[setting.Path] && setting.Value != "" {
+			value = []byte(`"***"`)
+		}
+		source := setting.Source
+		if setting.Origin != "" {
+			source += " " + setting.Origin
+		}
+		if _, err := fmt.Fprintf(w, "%-32s %-40s %s\n", setting.Path, value, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configLeaves lists the settings of a config section. Nested sections
+// are expanded; all other fields, including lists and maps, are settings.
+func configLeaves(t reflect.Type, prefix string) []*leaf {
+	var leaves []*leaf
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		if field.Type.Kind() == reflect.Struct {
+			leaves = append(leaves, configLeaves(field.Type, path+".")...)
+		} else {
+			leaves = append(leaves, &leaf{path, field.Type})
+		}
+	}
+	return leaves
+}
+
+// parse parses the value of a setting from an environment variable or
+// a flag. Lists of strings may be given separated by commas; lists and
+// maps of other types must be given as JSON.
+func (l *leaf) parse(raw string, origin string) (interface{}, error) {
+	typ := l.typ
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b, nil
+		}
+	case reflect.Int, reflect.Int64:
+		if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return i, nil
+		}
+	case reflect.Slice:
+		trimmed := strings.TrimSpace(raw)
+		if typ.Elem().Kind() == reflect.String && !strings.HasPrefix(trimmed, "[") {
+			values := make([]string, 0)
+			for _, value := range strings.Split(raw, ",") {
+				if value = strings.TrimSpace(value); value != "" {
+					values = append(values, value)
+				}
+			}
+			return values, nil
+		}
+		fallthrough
+	default:
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err == nil {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid value %s for %s in %s", raw, l.path, origin)
+}
+
+// envName returns the environment variable of a setting,
+// e.g. DOCSAN_LOGGING_LEVEL for logging.level.
+func envName(path string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(path, ".", "_", -1))
+}
+
+// toMap converts a config to nested maps.
+func toMap(config *Config) map[string]interface{} {
+	data, _ := json.Marshal(config)
+	m := make(map[string]interface{})
+	json.Unmarshal(data, &m)
+	return m
+}
+
+// lookup gets the value at a dotted path in nested maps.
+func lookup(m map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := m[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = nested
+	}
+	value, present := m[keys[len(keys)-1]]
+	return value, present
+}
+
+// put sets the value at a dotted path in nested maps.
+func put(m map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := m[key].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			m[key] = nested
+		}
+		m = nested
+	}
+	m[keys[len(keys)-1]] = value
+}
+
+// String returns the value of the flag.
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+// Set sets the value of the flag.
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	f.set = true
+	return nil
+}
+
+// IsBoolFlag allows boolean settings to be given as a flag without value.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.leaf.typ.Kind() == reflect.Bool
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+
+	"ibfd.org/docsan/codes"
+	"ibfd.org/docsan/config"
+)
+
+// configCommand executes a subcommand of the config command. The print
+// subcommand writes the effective settings and where they came from.
+func configCommand(subcommand string) {
+	if subcommand != "print" {
+		appLog.LogFatal(codes.ConfigUsage)
+	}
+	if err := config.PrintSettings(os.Stdout); err != nil {
+		appLog.LogFatal(codes.ConfigPrint, err)
+	}
+}
@@ -0,0 +1,151 @@
+package corpus
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"ibfd.org/docsan/codes"
+	log "ibfd.org/docsan/log4u"
+	"ibfd.org/docsan/render"
+)
+
+// loggerName defines the name of the logger of the corpus package.
+const loggerName = "corpus"
+
+// These constants define the kinds of problems the checker reports.
+const (
+	MissingAnchor         = "missing-anchor"
+	MissingDocument       = "missing-document"
+	MissingDocumentAnchor = "missing-document-anchor"
+	MissingOutlineAnchor  = "missing-outline-anchor"
+	MissingTocAnchor      = "missing-toc-anchor"
+)
+
+// Corpus defines the links of a set of documents keyed by document id.
+// Only the links and anchors of the documents are kept.
+type Corpus struct {
+	Documents map[string]*render.LinkIndex
+}
+
+// Problem defines a broken link or anchor found in a document.
+type Problem struct {
+	Kind     string `json:"kind"`
+	Href     string `json:"href,omitempty"`
+	Text     string `json:"text,omitempty"`
+	DocID    string `json:"docid,omitempty"`
+	Fragment string `json:"fragment,omitempty"`
+}
+
+// Report defines the result of checking a corpus.
+type Report struct {
+	Documents int                   `json:"documents"`
+	Problems  int                   `json:"problems"`
+	Report    map[string][]*Problem `json:"report"`
+}
+
+// Load converts all HTML documents in a directory and its subdirectories.
+func Load(df *render.DocumentFactory, dir string) (*Corpus, error) {
+	corpus := &Corpus{make(map[string]*render.LinkIndex)}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isHTML(path) {
+			return nil
+		}
+		document, err := convert(df, path)
+		if err != nil {
+			return err
+		}
+		docID := document.DocID
+		if docID == render.UnknownDocID {
+			docID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		if _, present := corpus.Documents[docID]; present {
+			log.Named(loggerName).Log(codes.DuplicateDocID, docID, path)
+			return nil
+		}
+		index := document.LinkIndex()
+		index.DocID = docID
+		corpus.Documents[docID] = index
+		return nil
+	})
+	return corpus, err
+}
+
+// Check checks all documents in the corpus for broken links and anchors.
+func (corpus *Corpus) Check() *Report {
+	report := &Report{Documents: len(corpus.Documents), Report: make(map[string][]*Problem)}
+	for _, docID := range corpus.docIDs() {
+		problems := corpus.checkDocument(corpus.Documents[docID])
+		if len(problems) > 0 {
+			report.Report[docID] = problems
+			report.Problems += len(problems)
+		}
+	}
+	return report
+}
+
+func (corpus *Corpus) checkDocument(document *render.LinkIndex) []*Problem {
+	problems := make([]*Problem, 0)
+	for _, link := range document.Hyperlinks {
+		switch link.Kind {
+		case render.LinkInternal:
+			if link.Fragment != "" && !document.HasAnchor(link.Fragment) {
+				problems = append(problems, newProblem(MissingAnchor, link))
+			}
+		case render.LinkDocument:
+			target, present := corpus.Documents[link.DocID]
+			if !present {
+				problems = append(problems, newProblem(MissingDocument, link))
+			} else if link.Fragment != "" && !target.HasAnchor(link.Fragment) {
+				problems = append(problems, newProblem(MissingDocumentAnchor, link))
+			}
+		}
+	}
+	for _, target := range document.OutlineTargets {
+		if !document.HasAnchor(target) {
+			problems = append(problems, &Problem{Kind: MissingOutlineAnchor, Fragment: target})
+		}
+	}
+	for _, target := range document.TocTargets {
+		if !document.HasAnchor(target) {
+			problems = append(problems, &Problem{Kind: MissingTocAnchor, Fragment: target})
+		}
+	}
+	return problems
+}
+
+func (corpus *Corpus) docIDs() []string {
+	docIDs := make([]string, 0, len(corpus.Documents))
+	for docID := range corpus.Documents {
+		docIDs = append(docIDs, docID)
+	}
+	sort.Strings(docIDs)
+	return docIDs
+}
+
+func newProblem(kind string, link *render.Hyperlink) *Problem {
+	return &Problem{Kind: kind, Href: link.Href, Text: link.Text, DocID: link.DocID, Fragment: link.Fragment}
+}
+
+func convert(df *render.DocumentFactory, path string) (*render.Document, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	htmlDoc, err := html.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return df.TransformFrom(htmlDoc, &render.Origin{Filename: path}), nil
+}
+
+func isHTML(path string) bool {
+	return render.IsDocumentPath(filepath.ToSlash(path))
+}
@@ -0,0 +1,53 @@
+package corpus
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"ibfd.org/docsan/render"
+)
+
+func writeDocument(t *testing.T, dir string, name string, body string) {
+	content := "<html><head><title>" + name + "</title></head><body>" + body + "</body></html>"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckReportsBrokenLinks(t *testing.T) {
+	dir := t.TempDir()
+	writeDocument(t, dir, "a.html", `<h1 id="top">A</h1>
+		<a href="#">back to top</a>
+		<a href="#" onclick="toggle()">toggle</a>
+		<a href="#top">top</a>
+		<a href="#missing">missing</a>
+		<a href="b.htm#x">b</a>
+		<a href="b.htm#y">b</a>
+		<a href="c.html">c</a>
+		<a href="images/chart.png">chart</a>`)
+	writeDocument(t, dir, "b.htm", `<p id="x">B</p>`)
+	writeDocument(t, dir, "notes.txt", `<a href="#missing">not a document</a>`)
+	corpus, err := Load(render.NewDocumentFactory("test"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := corpus.Check()
+	if report.Documents != 2 {
+		t.Errorf("%d documents checked, want 2", report.Documents)
+	}
+	want := []Problem{
+		{Kind: MissingAnchor, Href: "#missing", Text: "missing", Fragment: "missing"},
+		{Kind: MissingDocumentAnchor, Href: "b.htm#y", Text: "b", DocID: "b", Fragment: "y"},
+		{Kind: MissingDocument, Href: "c.html", Text: "c", DocID: "c"},
+	}
+	problems := report.Report["a"]
+	if report.Problems != len(want) || len(problems) != len(want) {
+		t.Fatalf("%d problems reported, want %d: %v", report.Problems, len(want), report.Report)
+	}
+	for i, problem := range problems {
+		if *problem != want[i] {
+			t.Errorf("problem %d is %+v, want %+v", i, *problem, want[i])
+		}
+	}
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"golang.org/x/net/html"
+	"ibfd.org/docsan/codes"
 	"ibfd.org/docsan/config"
 	log "ibfd.org/docsan/log4u"
 	"ibfd.org/docsan/render"
@@ -17,23 +29,73 @@ import (
 
 var noFileError error
 
+// appLog logs the messages of the service and the link checker.
+var appLog = log.Named("docsan")
+
+// factory holds the document factory for the current config. It is
+// replaced when the config is reloaded; a request keeps using the
+// factory it started with.
+var factory atomic.Value
+
+// shutdownTimeout limits the time to finish requests when the service stops.
+const shutdownTimeout = 10 * time.Second
+
+// requestIDHeader defines the header that carries the id of a request.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID defines the request ids that are accepted from a client.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
 func main() {
+	config.Init()
 	defer config.CloseLog()
+	switch config.Command() {
+	case "linkcheck":
+		linkCheck(config.CommandArgs())
+	case "config":
+		configCommand(config.Subcommand())
+	default:
+		serve()
+	}
+}
+
+func serve() {
 	noFileError = errors.New("no file provided")
 	server := http.Server{Addr: ":" + config.GetPort()}
-	log.Infof("%s started on %s", appName(), server.Addr)
-	df := render.NewDocumentFactory(appName())
-	http.HandleFunc("/", handler(df))
+	appLog.Log(codes.ServerStarted, appName(), server.Addr)
+	factory.Store(render.NewDocumentFactory(appName()))
+	config.Watch(func(changed []string) {
+		factory.Store(render.NewDocumentFactory(appName()))
+		if config.LoggingChanged(changed) {
+			reverter.cancel()
+		}
+	})
+	http.HandleFunc(levelsPath, adminHandler(handleLevels))
+	http.HandleFunc(statsPath, adminHandler(handleLogStats))
+	http.HandleFunc("/", handler())
+	go shutdownOnSignal(&server)
 	server.ListenAndServe()
 }
 
-func handler(df *render.DocumentFactory) http.HandlerFunc {
+// shutdownOnSignal stops the server gracefully on SIGINT or SIGTERM,
+// so the deferred cleanup in main flushes the log.
+func shutdownOnSignal(server *http.Server) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sig := <-stop
+	appLog.Log(codes.ServerStopping, appName(), sig)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	server.Shutdown(ctx)
+}
+
+func handler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "GET":
 			showForm(w)
 		case "POST":
-			process(df, w, r)
+			process(factory.Load().(*render.DocumentFactory), w, r)
 		default:
 		}
 	}
@@ -59,12 +121,15 @@ func showForm(w http.ResponseWriter) {
 
 func process(df *render.DocumentFactory, w http.ResponseWriter, r *http.Request) {
 	defer serverError(w, r)
-	reader, err := getReader(r)
+	requestID := getRequestID(r)
+	w.Header().Set(requestIDHeader, requestID)
+	reqLog := appLog.With("request_id", requestID, "client", r.RemoteAddr)
+	reader, filename, err := getReader(r)
 	if err != nil {
 		if err == noFileError {
 			writeError(w, 400, err.Error())
 		} else {
-			writeError(w, 500, fmt.Sprintf("failed to sanitize: %v", err))
+			writeServerError(w, r, reqLog, fmt.Errorf("failed to sanitize: %v", err))
 		}
 	} else {
 		total := timer()
@@ -72,53 +137,121 @@ func process(df *render.DocumentFactory, w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			writeError(w, 400, fmt.Sprintf("failed to parse HTML: %v", err))
 		} else {
-			document := df.Transform(htmlDoc)
-			json, err := document.ToJSON()
-			if err != nil {
-				msg := fmt.Sprintf("failed to sanitize %s: %v", document.DocID, err)
-				writeError(w, 400, msg)
-				log.Errorf(msg)
+			origin := &render.Origin{Filename: filename, Header: r.Header, Query: r.URL.Query(), Log: reqLog}
+			document := df.TransformFrom(htmlDoc, origin)
+			docLog := reqLog.With("docid", document.DocID)
+			if strictMode(r, df.Config()) && document.HasErrors() {
+				writeDiagnostics(w, r, docLog, document)
 			} else {
 				setServer(w)
 				w.Header().Set("Content-Type", "application/json; charset=utf-8")
-				w.WriteHeader(200)
-				w.Write(json)
-				if document.DocID != "" {
-					log.Debugf("%s: transforming %s took %s", r.Host, document.DocID, total())
+				out := &responseTracker{ResponseWriter: w}
+				err := document.ToJSON(out)
+				if err != nil && !out.written {
+					w.Header().Del("Content-Type")
+					docLog.Log(codes.RequestFailed, r.Method, r.URL.Path, http.StatusBadRequest, err)
+					writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to sanitize %s: %v", document.DocID, err))
+				} else if err != nil {
+					docLog.Log(codes.WriteFailed, document.DocID, err)
+				} else if document.DocID != "" {
+					docLog.Log(codes.TransformTiming, r.Host, document.DocID, total())
 				}
 			}
 		}
 	}
 }
 
-func writeError(w http.ResponseWriter, status int, msg string) {
-	if status >= 500 {
-		log.Errorf(msg)
+// responseTracker records whether anything was written to a response,
+// so that a response can still be replaced by an error.
+type responseTracker struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (t *responseTracker) Write(data []byte) (int, error) {
+	t.written = true
+	return t.ResponseWriter.Write(data)
+}
+
+// getRequestID gets the request id from the request header. A new id
+// is generated if the client did not supply a valid one.
+func getRequestID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get(requestIDHeader)); validRequestID.MatchString(id) {
+		return id
 	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// strictMode determines whether documents with errors must be rejected.
+// The strict query parameter overrides the configured default.
+func strictMode(r *http.Request, snapshot *config.Snapshot) bool {
+	if strict, err := strconv.ParseBool(r.URL.Query().Get("strict")); err == nil {
+		return strict
+	}
+	return snapshot.Strict()
+}
+
+// writeDiagnostics rejects a document by writing its diagnostics
+// and schema violations.
+func writeDiagnostics(w http.ResponseWriter, r *http.Request, logger *log.Logger, document *render.Document) {
+	response := struct {
+		DocID       string               `json:"docid"`
+		Diagnostics []*render.Diagnostic `json:"diagnostics"`
+		Violations  []*render.Violation  `json:"violations,omitempty"`
+	}{document.DocID, document.Diagnostics, document.Violations}
+	data, err := json.Marshal(response)
+	if err != nil {
+		writeServerError(w, r, logger, fmt.Errorf("failed to write diagnostics for %s: %v", document.DocID, err))
+		return
+	}
+	logger.Log(codes.StrictRejected, document.DocID)
+	setServer(w)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(data)
+}
+
+// writeServerError logs a server error and writes it as the response.
+func writeServerError(w http.ResponseWriter, r *http.Request, logger *log.Logger, err error) {
+	logger.Log(codes.RequestFailed, r.Method, r.URL.Path, http.StatusInternalServerError, err)
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
 	setServer(w)
 	w.WriteHeader(status)
 	w.Write([]byte(msg))
 }
 
-func getReader(r *http.Request) (io.Reader, error) {
+// getReader gets the uploaded document and its filename, if known.
+func getReader(r *http.Request) (io.Reader, string, error) {
 	contentType := r.Header["Content-Type"]
 	if contentType != nil && strings.HasPrefix(contentType[0], "multipart/form-data") {
 		r.ParseMultipartForm(1 << 20)
 		fileHeaders := r.MultipartForm.File["upload"]
 		if fileHeaders == nil {
-			return nil, noFileError
+			return nil, "", noFileError
 		}
 		fileHeader := fileHeaders[0]
-		return fileHeader.Open()
+		file, err := fileHeader.Open()
+		return file, fileHeader.Filename, err
+	}
+	var filename string
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+		filename = params["filename"]
 	}
-	return r.Body, nil
+	return r.Body, filename, nil
 }
 
 // ServerError maps errors to internal server errors.
 func serverError(w http.ResponseWriter, rec *http.Request) {
 	if r := recover(); r != nil {
 		msg := fmt.Sprintf("%v", r)
-		log.Error(msg)
+		appLog.Log(codes.RequestPanicked, rec.Method, rec.URL.Path, r)
 		logStackDump()
 		setServer(w)
 		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
@@ -133,7 +266,7 @@ func logStackDump() {
 	stackdump := string(buf[0:stackSize])
 	entries := strings.Split(stackdump, "\n")
 	for _, entry := range entries {
-		log.Errorf("\t%s", entry)
+		appLog.Log(codes.StackDump, entry)
 	}
 }
 
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGetRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	tests := []struct {
+		header string
+		id     string
+	}{
+		{"", ""},
+		{" req-1.A_b ", "req-1.A_b"},
+		{strings.Repeat("a", 64), strings.Repeat("a", 64)},
+		{strings.Repeat("a", 65), ""},
+		{"id with spaces", ""},
+		{"evil\"}\n{\"level\":\"ERROR", ""},
+		{"ünïcode", ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set(requestIDHeader, test.header)
+		id := getRequestID(r)
+		if test.id != "" && id != test.id {
+			t.Errorf("request id for %q is %q, want %q", test.header, id, test.id)
+		}
+		if test.id == "" && !generated.MatchString(id) {
+			t.Errorf("request id for %q is %q, want a generated id", test.header, id)
+		}
+	}
+}
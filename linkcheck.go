@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"ibfd.org/docsan/codes"
+	"ibfd.org/docsan/config"
+	"ibfd.org/docsan/corpus"
+	"ibfd.org/docsan/render"
+)
+
+// linkCheck converts all documents in a directory and writes a report
+// of broken links and anchors to standard output. The process exits
+// with status 1 if the report contains problems.
+func linkCheck(args []string) {
+	if len(args) == 0 {
+		appLog.LogFatal(codes.LinkCheckUsage)
+	}
+	df := render.NewDocumentFactory(appName())
+	docs, err := corpus.Load(df, args[0])
+	if err != nil {
+		appLog.LogFatal(codes.LinkCheckLoad, args[0], err)
+	}
+	report := docs.Check()
+	encoder := json.NewEncoder(os.Stdout)
+	if df.Config().JSONPretty() {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(report); err != nil {
+		appLog.LogFatal(codes.LinkCheckReport, err)
+	}
+	if report.Problems > 0 {
+		config.CloseLog()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,207 @@
+package log4u
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy defines what an asynchronous writer does when its queue is full.
+type OverflowPolicy int
+
+// These constants define the available overflow policies.
+const (
+	OverflowBlock OverflowPolicy = iota // wait until the queue has room
+	OverflowDrop                        // drop the message and count it
+)
+
+var policyNames = []string{"block", "drop"}
+
+// ParseOverflowPolicy parses the name of an overflow policy: block or drop.
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for i, policyName := range policyNames {
+		if strings.EqualFold(policyName, name) {
+			return OverflowPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy %s", name)
+}
+
+// String returns the name of an overflow policy.
+func (policy OverflowPolicy) String() string {
+	return policyNames[policy]
+}
+
+// flusher is implemented by outputs that buffer messages.
+type flusher interface {
+	Flush() error
+}
+
+// AsyncWriter defines a writer that queues messages and writes them to
+// its output in the background, so logging does not wait for a slow output.
+// The queue is bounded; the overflow policy decides what happens when it
+// is full. After Close messages are written directly to the output.
+type AsyncWriter struct {
+	out     io.Writer
+	policy  OverflowPolicy
+	queue   chan []byte
+	flushes chan chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	state   sync.RWMutex // guards closed, so no message is queued after Close
+	closed  bool
+	dropped uint64
+	mu      sync.Mutex // serializes direct writes after Close
+	once    sync.Once
+}
+
+// NewAsyncWriter creates an asynchronous writer with a queue of the given size.
+func NewAsyncWriter(out io.Writer, size int, policy OverflowPolicy) *AsyncWriter {
+	w := &AsyncWriter{
+		out:     out,
+		policy:  policy,
+		queue:   make(chan []byte, size),
+		flushes: make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+// Write queues a copy of a message. Returns an error if the message
+// was dropped because the queue is full.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.state.RLock()
+	defer w.state.RUnlock()
+	if w.closed {
+		return w.writeDirect(p)
+	}
+	msg := make([]byte, len(p))
+	copy(msg, p)
+	if w.policy == OverflowDrop {
+		select {
+		case w.queue <- msg:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+			return 0, fmt.Errorf("log queue full, message dropped")
+		}
+	} else {
+		// the writer is not closed while the message waits for room
+		w.queue <- msg
+	}
+	return len(p), nil
+}
+
+// writeDirect writes a message to the output after the writer was closed.
+func (w *AsyncWriter) writeDirect(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
+}
+
+// Flush waits until all queued messages are written.
+func (w *AsyncWriter) Flush() error {
+	w.state.RLock()
+	closed := w.closed
+	w.state.RUnlock()
+	if closed {
+		return nil
+	}
+	done := make(chan struct{})
+	select {
+	case w.flushes <- done:
+		<-done
+	case <-w.stopped:
+	}
+	return nil
+}
+
+// Close writes all queued messages and stops writing in the background.
+// Writes that are in progress are queued first; direct writes wait
+// until the queue is drained.
+func (w *AsyncWriter) Close() error {
+	w.once.Do(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.state.Lock()
+		w.closed = true
+		w.state.Unlock()
+		close(w.stop)
+		<-w.stopped
+	})
+	return nil
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (w *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Queued returns the number of messages waiting to be written.
+func (w *AsyncWriter) Queued() int {
+	return len(w.queue)
+}
+
+// Capacity returns the size of the queue.
+func (w *AsyncWriter) Capacity() int {
+	return cap(w.queue)
+}
+
+// Policy returns the overflow policy of the writer.
+func (w *AsyncWriter) Policy() OverflowPolicy {
+	return w.policy
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.stopped)
+	for {
+		select {
+		case msg := <-w.queue:
+			w.out.Write(msg)
+		case done := <-w.flushes:
+			w.drain()
+			close(done)
+		case <-w.stop:
+			w.drain()
+			return
+		}
+	}
+}
+
+// drain writes the messages that are in the queue.
+func (w *AsyncWriter) drain() {
+	for {
+		select {
+		case msg := <-w.queue:
+			w.out.Write(msg)
+		default:
+			return
+		}
+	}
+}
+
+// syncOutput makes the output of the logger synchronous if it is an
+// asynchronous writer: queued messages are written and later messages
+// are written directly. Called before the process exits on Fatal.
+func (l *Logger) syncOutput() {
+	l = l.root()
+	l.mu.Lock()
+	out := l.out
+	l.mu.Unlock()
+	if w, ok := out.(*AsyncWriter); ok {
+		w.Close()
+	}
+}
+
+// Flush waits until the queued messages of the standard logger are
+// written if its output is an asynchronous writer.
+func Flush() {
+	std.mu.Lock()
+	out := std.out
+	std.mu.Unlock()
+	if f, ok := out.(flusher); ok {
+		f.Flush()
+	}
+}
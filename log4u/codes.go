@@ -0,0 +1,166 @@
+package log4u
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Code defines a message code with its default severity, a description
+// of the event it reports and the template of its message.
+type Code struct {
+	ID          string
+	Level       LogLevel
+	Description string
+	Template    string
+}
+
+// keyCode defines the field that carries the message code.
+const keyCode = "code"
+
+// catalogue holds the registered message codes and their severity overrides.
+var catalogue = struct {
+	sync.RWMutex
+	codes     map[string]*Code
+	overrides map[string]LogLevel
+}{codes: make(map[string]*Code), overrides: make(map[string]LogLevel)}
+
+// NewCode creates a message code and adds it to the catalogue.
+// It panics if a code with the same id was registered before.
+func NewCode(id string, level LogLevel, description string, template string) *Code {
+	catalogue.Lock()
+	defer catalogue.Unlock()
+	if _, present := catalogue.codes[id]; present {
+		panic("log4u: duplicate message code " + id)
+	}
+	code := &Code{id, level, description, template}
+	catalogue.codes[id] = code
+	return code
+}
+
+// Codes returns the message codes in the catalogue sorted by id.
+func Codes() []*Code {
+	catalogue.RLock()
+	defer catalogue.RUnlock()
+	codes := make([]*Code, 0, len(catalogue.codes))
+	for _, code := range catalogue.codes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].ID < codes[j].ID })
+	return codes
+}
+
+// SetCodeLevel overrides the severity of a message code.
+// Returns an error if the code or the level is unknown.
+func SetCodeLevel(id string, level string) error {
+	logLevel, ok := parseLevel(level)
+	if !ok {
+		return fmt.Errorf("unknown level %s", level)
+	}
+	catalogue.Lock()
+	defer catalogue.Unlock()
+	if _, present := catalogue.codes[id]; !present {
+		return fmt.Errorf("unknown message code %s", id)
+	}
+	catalogue.overrides[id] = logLevel
+	return nil
+}
+
+// ParseCodeLevels parses severity overrides keyed by message code.
+// Returns an error if a code or a level is unknown.
+func ParseCodeLevels(levels map[string]string) (map[string]LogLevel, error) {
+	catalogue.RLock()
+	defer catalogue.RUnlock()
+	overrides := make(map[string]LogLevel, len(levels))
+	for id, level := range levels {
+		logLevel, ok := parseLevel(level)
+		if !ok {
+			return nil, fmt.Errorf("unknown level %s for %s", level, id)
+		}
+		if _, present := catalogue.codes[id]; !present {
+			return nil, fmt.Errorf("unknown message code %s", id)
+		}
+		overrides[id] = logLevel
+	}
+	return overrides, nil
+}
+
+// SetCodeLevels replaces all severity overrides of message codes.
+func SetCodeLevels(overrides map[string]LogLevel) {
+	catalogue.Lock()
+	defer catalogue.Unlock()
+	catalogue.overrides = make(map[string]LogLevel, len(overrides))
+	for id, level := range overrides {
+		catalogue.overrides[id] = level
+	}
+}
+
+// Severity returns the severity of the code, which is its
+// default level unless it was overridden.
+func (code *Code) Severity() LogLevel {
+	catalogue.RLock()
+	defer catalogue.RUnlock()
+	if level, present := catalogue.overrides[code.ID]; present {
+		return level
+	}
+	return code.Level
+}
+
+// Message formats the message of the code.
+// Arguments are handled in the manner of fmt.Printf.
+func (code *Code) Message(v ...interface{}) string {
+	return fmt.Sprintf(code.Template, v...)
+}
+
+// String returns the id of the code.
+func (code *Code) String() string {
+	return code.ID
+}
+
+// String returns the name of a logging level.
+func (level LogLevel) String() string {
+	return levelTags[level]
+}
+
+// Log calls l.Output to print the message of a code to the logger
+// if the severity of the code allows that. The code is logged as field.
+// Arguments are handled in the manner of fmt.Printf.
+func (l *Logger) Log(code *Code, v ...interface{}) {
+	if level := code.Severity(); l.mustLog(level) && l.allow(level, code.ID) {
+		l.OutputFields(2, level, code.Message(v...), Fields{keyCode: code.ID})
+	}
+}
+
+// LogFatal is equivalent to l.Log() followed by a call to os.Exit(1).
+func (l *Logger) LogFatal(code *Code, v ...interface{}) {
+	l.syncOutput()
+	l.OutputFields(2, code.Severity(), code.Message(v...), Fields{keyCode: code.ID})
+	l.exit()
+}
+
+// Log calls Output to print the message of a code to the standard
+// logger if the severity of the code allows that.
+// Arguments are handled in the manner of fmt.Printf.
+func Log(code *Code, v ...interface{}) {
+	if level := code.Severity(); std.mustLog(level) && std.allow(level, code.ID) {
+		std.OutputFields(2, level, code.Message(v...), Fields{keyCode: code.ID})
+	}
+}
+
+// LogFatal is equivalent to Log() followed by a call to os.Exit(1).
+func LogFatal(code *Code, v ...interface{}) {
+	std.syncOutput()
+	std.OutputFields(2, code.Severity(), code.Message(v...), Fields{keyCode: code.ID})
+	std.exit()
+}
+
+// parseLevel parses the name of a logging level.
+func parseLevel(name string) (LogLevel, bool) {
+	for i, tag := range levelTags {
+		if strings.EqualFold(tag, name) {
+			return LogLevel(i), true
+		}
+	}
+	return 0, false
+}
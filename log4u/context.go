@@ -0,0 +1,82 @@
+package log4u
+
+import (
+	"fmt"
+	"sort"
+)
+
+// With returns a child logger that adds context fields to every message
+// it logs. The fields are given as alternating keys and values, e.g.
+// With("docid", docID, "step", "render"). A child logger writes through
+// its root logger and shares its level, flags, format and output.
+// It keeps the name of the logger.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make(Fields, len(l.fields)+len(keyvals)/2)
+	for key, value := range l.fields {
+		fields[key] = value
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "???"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fields[fmt.Sprint(keyvals[i])] = value
+	}
+	return &Logger{parent: l.root(), fields: fields, name: l.name}
+}
+
+// Fields returns a copy of the context fields of the logger.
+func (l *Logger) Fields() Fields {
+	return l.withFields(nil)
+}
+
+// root returns the logger that writes the output of a logger.
+func (l *Logger) root() *Logger {
+	if l.parent != nil {
+		return l.parent
+	}
+	return l
+}
+
+// withFields merges fields with the context fields of the logger.
+// The supplied fields take precedence.
+func (l *Logger) withFields(fields Fields) Fields {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return merged
+}
+
+// formatContext writes the fields to buf as [key=value ...]
+// sorted by key, or as [???] if there are no fields.
+func formatContext(buf *[]byte, fields Fields) {
+	if len(fields) == 0 {
+		*buf = append(*buf, "[???] "...)
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	*buf = append(*buf, '[')
+	for i, key := range keys {
+		if i > 0 {
+			*buf = append(*buf, ' ')
+		}
+		*buf = append(*buf, key...)
+		*buf = append(*buf, '=')
+		*buf = append(*buf, fmt.Sprint(fields[key])...)
+	}
+	*buf = append(*buf, ']', ' ')
+}
+
+// With returns a child logger of the standard logger that adds
+// context fields to every message it logs.
+func With(keyvals ...interface{}) *Logger {
+	return std.With(keyvals...)
+}
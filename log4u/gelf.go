@@ -0,0 +1,133 @@
+package log4u
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// These constants define the chunking of GELF messages over UDP.
+const (
+	gelfChunkSize  = 8192
+	gelfHeaderSize = 12
+	gelfMaxChunks  = 128
+)
+
+// gelfFieldName matches the names GELF accepts for additional fields.
+var gelfFieldName = regexp.MustCompile(`^[\w.\-]+$`)
+
+// GELFOutput defines an output that sends entries to a Graylog server in
+// the GELF 1.1 format. Over UDP large messages are chunked, over TCP
+// messages are terminated by a null byte. Fields are sent as additional
+// fields, prefixed with an underscore.
+type GELFOutput struct {
+	conn     *netConn
+	hostname string
+	chunked  bool
+}
+
+// NewGELFOutput creates a GELF output for a server at an address
+// reachable over udp or tcp. The connection is made on the first write.
+func NewGELFOutput(network string, address string) (*GELFOutput, error) {
+	if !ValidNetwork(network) {
+		return nil, fmt.Errorf("unsupported network %s", network)
+	}
+	host := hostname()
+	if host == "" {
+		host = "unknown"
+	}
+	return &GELFOutput{conn: newNetConn(network, address), hostname: host, chunked: network == "udp"}, nil
+}
+
+// WriteEntry sends an entry to the Graylog server.
+func (o *GELFOutput) WriteEntry(entry *Entry) error {
+	msg, err := o.format(entry)
+	if err != nil {
+		return err
+	}
+	if !o.chunked {
+		return o.conn.write(append(msg, 0))
+	}
+	if len(msg) <= gelfChunkSize {
+		return o.conn.write(msg)
+	}
+	chunks, err := gelfChunks(msg)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := o.conn.write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection to the Graylog server.
+func (o *GELFOutput) Close() error {
+	return o.conn.close()
+}
+
+func (o *GELFOutput) format(entry *Entry) ([]byte, error) {
+	message := strings.TrimSpace(entry.Prefix + strings.TrimSuffix(entry.Message, "\n"))
+	short := message
+	if i := strings.IndexByte(short, '\n'); i >= 0 {
+		short = short[:i]
+	}
+	gelf := map[string]interface{}{
+		"version":       "1.1",
+		"host":          o.hostname,
+		"short_message": short,
+		"timestamp":     float64(entry.Time.UnixNano()/int64(1e6)) / 1e3,
+		"level":         syslogSeverity(entry.Level),
+		"_level_name":   levelTags[entry.Level]}
+	if short != message {
+		gelf["full_message"] = message
+	}
+	if entry.Caller != "" {
+		gelf["_"+keyCaller] = entry.Caller
+	}
+	for key, value := range entry.Fields {
+		if !gelfFieldName.MatchString(key) || key == "id" {
+			continue
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		if _, err := json.Marshal(value); err != nil {
+			value = fmt.Sprint(value)
+		}
+		gelf["_"+key] = value
+	}
+	return json.Marshal(gelf)
+}
+
+// gelfChunks splits a message into GELF chunks, each with the magic
+// bytes, a message id, its sequence number and the number of chunks.
+func gelfChunks(msg []byte) ([][]byte, error) {
+	size := gelfChunkSize - gelfHeaderSize
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("message of %d bytes too large for GELF over UDP", len(msg))
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk := make([]byte, 0, gelfHeaderSize+end-i*size)
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*size:end]...)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
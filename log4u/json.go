@@ -0,0 +1,87 @@
+package log4u
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// These constants define the reserved keys of JSON log lines.
+const (
+	keyTimestamp = "timestamp"
+	keyLevel     = "level"
+	keyCaller    = "caller"
+	keyPrefix    = "prefix"
+	keyMessage   = "message"
+)
+
+// formatJSON writes a log line as a JSON object in following order:
+//   - timestamp in RFC 3339 format with milliseconds,
+//   - the logging level,
+//   - the caller as file:method:line (if file information is available),
+//   - l.prefix (if it's not blank),
+//   - the message,
+//   - the fields, sorted by key.
+func (l *Logger) formatJSON(level LogLevel, buf *[]byte, t time.Time, method string, file string, line int, s string, fields Fields) {
+	if l.flag&LUTC != 0 {
+		t = t.UTC()
+	}
+	*buf = append(*buf, '{')
+	appendJSONField(buf, keyTimestamp, t.Format("2006-01-02T15:04:05.000Z07:00"), true)
+	appendJSONField(buf, keyLevel, levelTags[level], false)
+	if caller := l.caller(method, file, line); caller != "" {
+		appendJSONField(buf, keyCaller, caller, false)
+	}
+	if l.prefix != "" {
+		appendJSONField(buf, keyPrefix, strings.TrimSpace(l.prefix), false)
+	}
+	appendJSONField(buf, keyMessage, strings.TrimSuffix(s, "\n"), false)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch key {
+		case keyTimestamp, keyLevel, keyCaller, keyPrefix, keyMessage:
+			appendJSONField(buf, "field."+key, fields[key], false)
+		default:
+			appendJSONField(buf, key, fields[key], false)
+		}
+	}
+	*buf = append(*buf, '}', '\n')
+}
+
+// caller formats the caller as file:method:line, or returns
+// an empty string if file information is not available.
+func (l *Logger) caller(method string, file string, line int) string {
+	if file == "" {
+		return ""
+	}
+	if l.flag&Llongfile == 0 {
+		file = file[strings.LastIndex(file, "/")+1:]
+	}
+	var lineBuf []byte
+	itoa(&lineBuf, line, -1)
+	return file + ":" + method + ":" + string(lineBuf)
+}
+
+// appendJSONField appends a key and its value to a JSON object.
+// Values that cannot be marshalled are written as strings.
+func appendJSONField(buf *[]byte, key string, value interface{}, first bool) {
+	if !first {
+		*buf = append(*buf, ',')
+	}
+	k, _ := json.Marshal(key)
+	*buf = append(*buf, k...)
+	*buf = append(*buf, ':')
+	if e, ok := value.(error); ok {
+		value = e.Error()
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(err.Error())
+	}
+	*buf = append(*buf, v...)
+}
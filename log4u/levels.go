@@ -0,0 +1,112 @@
+package log4u
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Named returns a child logger with a name, such as the name of the
+// package that uses it. If a level is set for the name, or for a parent
+// of the name in a dotted hierarchy such as render for render.outline,
+// then that level applies instead of the level of the logger.
+func (l *Logger) Named(name string) *Logger {
+	return &Logger{parent: l.root(), fields: l.withFields(nil), name: name}
+}
+
+// Name returns the name of the logger.
+func (l *Logger) Name() string {
+	return l.name
+}
+
+// Levels returns the levels of the named loggers as a specification
+// such as render=DEBUG,node=WARN, sorted by name.
+func (l *Logger) Levels() string {
+	l = l.root()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, 0, len(l.levels))
+	for name := range l.levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]string, len(names))
+	for i, name := range names {
+		entries[i] = name + "=" + levelTags[l.levels[name]]
+	}
+	return strings.Join(entries, ",")
+}
+
+// SetLevels replaces the levels of the named loggers by the levels in
+// a specification such as render=DEBUG,node=WARN. An empty specification
+// removes all levels of named loggers.
+func (l *Logger) SetLevels(spec string) error {
+	levels, err := ParseLevels(spec)
+	if err != nil {
+		return err
+	}
+	l = l.root()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.levels = levels
+	return nil
+}
+
+// ParseLevels parses a specification of levels of named loggers.
+func ParseLevels(spec string) (map[string]LogLevel, error) {
+	levels := make(map[string]LogLevel)
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid level %s, expected name=LEVEL", entry)
+		}
+		level, ok := parseLevel(strings.TrimSpace(parts[1]))
+		if !ok {
+			return nil, fmt.Errorf("unknown level %s for %s", parts[1], name)
+		}
+		levels[name] = level
+	}
+	return levels, nil
+}
+
+// ValidLevel checks whether a level name is known.
+func ValidLevel(level string) bool {
+	_, ok := parseLevel(level)
+	return ok
+}
+
+// levelOf returns the level of a named logger, which is the level of its
+// name or the closest parent name, or the level of the logger if there is
+// none. The caller must hold the lock.
+func (l *Logger) levelOf(name string) LogLevel {
+	for name != "" {
+		if level, present := l.levels[name]; present {
+			return level
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return l.level
+}
+
+// Named returns a child logger of the standard logger with a name.
+func Named(name string) *Logger {
+	return std.Named(name)
+}
+
+// Levels returns the levels of the named loggers of the standard logger.
+func Levels() string {
+	return std.Levels()
+}
+
+// SetLevels sets the levels of the named loggers of the standard logger.
+func SetLevels(spec string) error {
+	return std.SetLevels(spec)
+}
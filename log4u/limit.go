@@ -0,0 +1,168 @@
+package log4u
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultMaxPayload defines the default length of payload snippets in log messages.
+const DefaultMaxPayload = 256
+
+// maxPayload holds the length of payload snippets; negative means unlimited.
+var maxPayload = struct {
+	sync.RWMutex
+	length int
+}{length: DefaultMaxPayload}
+
+// Limit defines how many messages with the same key are logged per interval.
+// The first Burst messages are logged; after that one in every Sample
+// messages is logged, or none if Sample is 0. The first error of every
+// interval is always logged.
+type Limit struct {
+	Burst  int
+	Sample int
+}
+
+// Limits defines the rate limiting of messages. Messages are keyed on
+// their code, or on their format template if they have no code. Messages
+// that exceed their limit are suppressed and summarized with the Summary
+// code at the end of every interval.
+type Limits struct {
+	Interval time.Duration
+	Default  Limit
+	Keys     map[string]Limit
+	Summary  *Code
+}
+
+// limiter counts the messages per key in the current interval.
+type limiter struct {
+	mu         sync.Mutex
+	limits     Limits
+	counts     map[string]int
+	suppressed map[string]int
+	stop       chan struct{}
+}
+
+// SetLimits sets the rate limiting of the logger and starts summarizing
+// suppressed messages. A zero interval switches rate limiting off.
+func (l *Logger) SetLimits(limits Limits) {
+	root := l.root()
+	var lim *limiter
+	if limits.Interval > 0 {
+		lim = &limiter{
+			limits:     limits,
+			counts:     make(map[string]int),
+			suppressed: make(map[string]int),
+			stop:       make(chan struct{})}
+	}
+	root.mu.Lock()
+	previous := root.limiter
+	root.limiter = lim
+	root.mu.Unlock()
+	if previous != nil {
+		close(previous.stop)
+		previous.summarize(root)
+	}
+	if lim != nil {
+		go lim.run(root)
+	}
+}
+
+// allow checks whether a message with the given level and key may be logged.
+func (l *Logger) allow(level LogLevel, key string) bool {
+	root := l.root()
+	root.mu.Lock()
+	lim := root.limiter
+	root.mu.Unlock()
+	if lim == nil {
+		return true
+	}
+	return lim.allow(level, key)
+}
+
+func (lim *limiter) allow(level LogLevel, key string) bool {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	limit, present := lim.limits.Keys[key]
+	if !present {
+		limit = lim.limits.Default
+	}
+	if level >= Lerror && limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	lim.counts[key]++
+	count := lim.counts[key]
+	if count <= limit.Burst || (limit.Sample > 0 && (count-limit.Burst)%limit.Sample == 0) {
+		return true
+	}
+	lim.suppressed[key]++
+	return false
+}
+
+// run summarizes the suppressed messages at the end of every interval.
+func (lim *limiter) run(l *Logger) {
+	ticker := time.NewTicker(lim.limits.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			lim.summarize(l)
+		case <-lim.stop:
+			return
+		}
+	}
+}
+
+// summarize logs the number of suppressed messages per key
+// and starts a new interval.
+func (lim *limiter) summarize(l *Logger) {
+	lim.mu.Lock()
+	suppressed := lim.suppressed
+	lim.counts = make(map[string]int)
+	lim.suppressed = make(map[string]int)
+	lim.mu.Unlock()
+	code := lim.limits.Summary
+	if code == nil || len(suppressed) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(suppressed))
+	for key := range suppressed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if level := code.Severity(); l.mustLog(level) {
+			l.OutputFields(2, level, code.Message(suppressed[key], key, lim.limits.Interval),
+				Fields{keyCode: code.ID, "suppressed": suppressed[key], "key": key})
+		}
+	}
+}
+
+// SetLimits sets the rate limiting of the standard logger.
+func SetLimits(limits Limits) {
+	std.SetLimits(limits)
+}
+
+// SetMaxPayload sets the length to which Snippet truncates payloads.
+// A negative length leaves payloads as they are.
+func SetMaxPayload(length int) {
+	maxPayload.Lock()
+	defer maxPayload.Unlock()
+	maxPayload.length = length
+}
+
+// Snippet truncates a payload, such as the content of a script, for
+// inclusion in a log message. The length of the payload is appended
+// if it was truncated.
+func Snippet(payload string) string {
+	maxPayload.RLock()
+	length := maxPayload.length
+	maxPayload.RUnlock()
+	if length < 0 || utf8.RuneCountInString(payload) <= length {
+		return payload
+	}
+	return fmt.Sprintf("%s... (%d bytes)", string([]rune(payload)[:length]), len(payload))
+}
@@ -0,0 +1,42 @@
+package log4u
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLimiterSamplesAfterBurst(t *testing.T) {
+	lim := &limiter{
+		limits:     Limits{Interval: time.Minute, Default: Limit{Burst: 2, Sample: 3}},
+		counts:     make(map[string]int),
+		suppressed: make(map[string]int)}
+	var allowed []int
+	for i := 1; i <= 8; i++ {
+		if lim.allow(Lwarn, "key") {
+			allowed = append(allowed, i)
+		}
+	}
+	if fmt.Sprint(allowed) != "[1 2 5 8]" {
+		t.Errorf("messages %v allowed, want [1 2 5 8]", allowed)
+	}
+	if lim.suppressed["key"] != 4 {
+		t.Errorf("%d messages suppressed, want 4", lim.suppressed["key"])
+	}
+}
+
+func TestLimiterNeverSuppressesEveryError(t *testing.T) {
+	lim := &limiter{
+		limits:     Limits{Interval: time.Minute},
+		counts:     make(map[string]int),
+		suppressed: make(map[string]int)}
+	if lim.allow(Lwarn, "warning") {
+		t.Error("warning allowed without burst or sample")
+	}
+	if !lim.allow(Lerror, "error") || !lim.allow(Lfatal, "fatal") {
+		t.Error("first error of the interval suppressed")
+	}
+	if lim.allow(Lerror, "error") {
+		t.Error("second error allowed without burst or sample")
+	}
+}
@@ -63,20 +63,40 @@ const (
 	Lfatal
 )
 
+// LineFormat defines the format of log lines.
+type LineFormat int
+
+// These constants define the available log line formats.
+const (
+	FormatText LineFormat = iota // [LEVEL] [date] [???] [file:method:line] ==> msg
+	FormatJSON                   // one JSON object per line
+)
+
+// Fields defines additional named values to log with a message.
+type Fields map[string]interface{}
+
 // A Logger represents an active logging object that generates lines of
 // output to an io.Writer. Each logging operation makes a single call to
 // the Writer's Write method. A Logger can be used simultaneously from
 // multiple goroutines; it guarantees to serialize access to the Writer.
 type Logger struct {
-	mu     sync.Mutex // ensures atomic writes; protects the following fields
-	prefix string     // prefix to write at beginning of each line
-	flag   int        // properties
-	level  LogLevel   // the logging level
-	out    io.Writer  // destination for output
-	buf    []byte     // for accumulating text to write
+	mu      sync.Mutex          // ensures atomic writes; protects the following fields
+	prefix  string              // prefix to write at beginning of each line
+	flag    int                 // properties
+	level   LogLevel            // the logging level
+	format  LineFormat          // the log line format
+	out     io.Writer           // destination for output
+	buf     []byte              // for accumulating text to write
+	parent  *Logger             // the root logger of a child logger
+	fields  Fields              // the context fields of a child logger
+	name    string              // the name of a child logger
+	levels  map[string]LogLevel // the levels of named loggers
+	outputs []EntryWriter       // structured outputs in addition to out
+	limiter *limiter            // the rate limiting of messages
 }
 
 var levelTags []string
+var formatNames = []string{"text", "json"}
 
 func init() {
 	levelTags = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
@@ -92,6 +112,7 @@ func New(out io.Writer, prefix string, flag int) *Logger {
 
 // SetOutput sets the output destination for the logger.
 func (l *Logger) SetOutput(w io.Writer) {
+	l = l.root()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	l.out = w
@@ -120,8 +141,9 @@ func itoa(buf *[]byte, i int, wid int) {
 //	 * the logging level
 //   * l.prefix (if it's not blank),
 //   * date and/or time (if corresponding flags are provided),
+//   * the context fields (??? if there are none),
 //   * file and line number (if corresponding flags are provided).
-func (l *Logger) formatHeader(level LogLevel, buf *[]byte, t time.Time, method string, file string, line int) {
+func (l *Logger) formatHeader(level LogLevel, buf *[]byte, t time.Time, method string, file string, line int, fields Fields) {
 	*buf = append(*buf, '[')
 	*buf = append(*buf, levelTags[level]...)
 	*buf = append(*buf, ']')
@@ -156,7 +178,7 @@ func (l *Logger) formatHeader(level LogLevel, buf *[]byte, t time.Time, method s
 		*buf = append(*buf, ']')
 		*buf = append(*buf, ' ')
 	}
-	*buf = append(*buf, "[???] "...)
+	formatContext(buf, fields)
 	if l.flag&(Lshortfile|Llongfile) != 0 {
 		*buf = append(*buf, '[')
 		if l.flag&Lshortfile != 0 {
@@ -186,6 +208,15 @@ func (l *Logger) formatHeader(level LogLevel, buf *[]byte, t time.Time, method s
 // provided for generality, although at the moment on all pre-defined
 // paths it will be 2.
 func (l *Logger) Output(calldepth int, level LogLevel, s string) error {
+	return l.OutputFields(calldepth+1, level, s, nil)
+}
+
+// OutputFields is like Output but also writes the supplied fields
+// and the context fields of the logger.
+func (l *Logger) OutputFields(calldepth int, level LogLevel, s string, fields Fields) error {
+	if l.parent != nil {
+		return l.parent.OutputFields(calldepth+1, level, s, l.withFields(fields))
+	}
 	now := time.Now() // get this early.
 	var pc uintptr
 	var method string
@@ -193,7 +224,7 @@ func (l *Logger) Output(calldepth int, level LogLevel, s string) error {
 	var line int
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if l.flag&(Lshortfile|Llongfile) != 0 {
+	if l.flag&(Lshortfile|Llongfile) != 0 || l.format == FormatJSON || len(l.outputs) > 0 {
 		// Release lock while getting caller info - it's expensive.
 		l.mu.Unlock()
 		var ok bool
@@ -213,13 +244,18 @@ func (l *Logger) Output(calldepth int, level LogLevel, s string) error {
 		l.mu.Lock()
 	}
 	l.buf = l.buf[:0]
-	l.formatHeader(level, &l.buf, now, method, file, line)
-	l.buf = append(l.buf, "==> "...)
-	l.buf = append(l.buf, s...)
-	if len(s) == 0 || s[len(s)-1] != '\n' {
-		l.buf = append(l.buf, '\n')
+	if l.format == FormatJSON {
+		l.formatJSON(level, &l.buf, now, method, file, line, s, fields)
+	} else {
+		l.formatHeader(level, &l.buf, now, method, file, line, fields)
+		l.buf = append(l.buf, "==> "...)
+		l.buf = append(l.buf, s...)
+		if len(s) == 0 || s[len(s)-1] != '\n' {
+			l.buf = append(l.buf, '\n')
+		}
 	}
 	_, err := l.out.Write(l.buf)
+	l.writeOutputs(level, now, method, file, line, s, fields)
 	return err
 }
 
@@ -227,7 +263,7 @@ func (l *Logger) Output(calldepth int, level LogLevel, s string) error {
 // if the current logging level allows that.
 // Arguments are handled in the manner of fmt.Printf.
 func (l *Logger) Debugf(format string, v ...interface{}) {
-	if l.mustLog(Ldebug) {
+	if l.mustLog(Ldebug) && l.allow(Ldebug, format) {
 		l.Output(2, Ldebug, fmt.Sprintf(format, v...))
 	}
 }
@@ -236,7 +272,7 @@ func (l *Logger) Debugf(format string, v ...interface{}) {
 // if the current logging level allows that.
 // Arguments are handled in the manner of fmt.Printf.
 func (l *Logger) Infof(format string, v ...interface{}) {
-	if l.mustLog(Linfo) {
+	if l.mustLog(Linfo) && l.allow(Linfo, format) {
 		l.Output(2, Linfo, fmt.Sprintf(format, v...))
 	}
 }
@@ -245,7 +281,7 @@ func (l *Logger) Infof(format string, v ...interface{}) {
 // if the current logging level allows that.
 // Arguments are handled in the manner of fmt.Printf.
 func (l *Logger) Warnf(format string, v ...interface{}) {
-	if l.mustLog(Lwarn) {
+	if l.mustLog(Lwarn) && l.allow(Lwarn, format) {
 		l.Output(2, Lwarn, fmt.Sprintf(format, v...))
 	}
 }
@@ -254,7 +290,7 @@ func (l *Logger) Warnf(format string, v ...interface{}) {
 // if the current logging level allows that.
 // Arguments are handled in the manner of fmt.Printf.
 func (l *Logger) Errorf(format string, v ...interface{}) {
-	if l.mustLog(Lerror) {
+	if l.mustLog(Lerror) && l.allow(Lerror, format) {
 		l.Output(2, Lerror, fmt.Sprintf(format, v...))
 	}
 }
@@ -339,20 +375,23 @@ func (l *Logger) Println(v ...interface{}) {
 
 // Fatal is equivalent to l.Print() followed by a call to os.Exit(1).
 func (l *Logger) Fatal(v ...interface{}) {
+	l.syncOutput()
 	l.Output(2, Lfatal, fmt.Sprint(v...))
-	os.Exit(1)
+	l.exit()
 }
 
 // Fatalf is equivalent to l.Printf() followed by a call to os.Exit(1).
 func (l *Logger) Fatalf(format string, v ...interface{}) {
+	l.syncOutput()
 	l.Output(2, Lfatal, fmt.Sprintf(format, v...))
-	os.Exit(1)
+	l.exit()
 }
 
 // Fatalln is equivalent to l.Println() followed by a call to os.Exit(1).
 func (l *Logger) Fatalln(v ...interface{}) {
+	l.syncOutput()
 	l.Output(2, Lfatal, fmt.Sprintln(v...))
-	os.Exit(1)
+	l.exit()
 }
 
 // Panic is equivalent to l.Print() followed by a call to panic().
@@ -382,6 +421,7 @@ func (l *Logger) mustLog(level LogLevel) bool {
 
 // Flags returns the output flags for the logger.
 func (l *Logger) Flags() int {
+	l = l.root()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	return l.flag
@@ -389,6 +429,7 @@ func (l *Logger) Flags() int {
 
 // SetFlags sets the output flags for the logger.
 func (l *Logger) SetFlags(flag int) {
+	l = l.root()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	l.flag = flag
@@ -396,6 +437,7 @@ func (l *Logger) SetFlags(flag int) {
 
 // Prefix returns the output prefix for the logger.
 func (l *Logger) Prefix() string {
+	l = l.root()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	return l.prefix
@@ -403,6 +445,7 @@ func (l *Logger) Prefix() string {
 
 // SetPrefix sets the output prefix for the logger.
 func (l *Logger) SetPrefix(prefix string) {
+	l = l.root()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	l.prefix = prefix
@@ -415,28 +458,48 @@ func (l *Logger) Level() string {
 
 // level return the current logging level
 func (l *Logger) getLevel() LogLevel {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.level
+	root := l.root()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	return root.levelOf(l.name)
 }
 
 // SetLevel sets the logging level.
 func (l *Logger) SetLevel(level string) {
-	for i, tag := range levelTags {
-		if strings.EqualFold(tag, level) {
-			l.setLevel(LogLevel(i))
-			return
-		}
+	if logLevel, ok := parseLevel(level); ok {
+		l.setLevel(logLevel)
 	}
 }
 
 // SetLevel sets the logging level
 func (l *Logger) setLevel(level LogLevel) {
+	l = l.root()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	l.level = level
 }
 
+// Format returns the log line format.
+func (l *Logger) Format() string {
+	l = l.root()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return formatNames[l.format]
+}
+
+// SetFormat sets the log line format: text or json.
+func (l *Logger) SetFormat(format string) {
+	l = l.root()
+	for i, name := range formatNames {
+		if strings.EqualFold(name, format) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.format = LineFormat(i)
+			return
+		}
+	}
+}
+
 // SetOutput sets the output destination for the standard logger.
 func SetOutput(w io.Writer) {
 	std.mu.Lock()
@@ -464,6 +527,16 @@ func SetLevel(level string) {
 	std.SetLevel(level)
 }
 
+// Format returns the log line format of the standard logger.
+func Format() string {
+	return std.Format()
+}
+
+// SetFormat sets the log line format of the standard logger: text or json.
+func SetFormat(format string) {
+	std.SetFormat(format)
+}
+
 // Prefix returns the output prefix for the standard logger.
 func Prefix() string {
 	return std.Prefix()
@@ -516,7 +589,7 @@ func Error(v ...interface{}) {
 // if the current logging level allows that.
 // Arguments are handled in the manner of fmt.Printf.
 func Debugf(format string, v ...interface{}) {
-	if std.mustLog(Ldebug) {
+	if std.mustLog(Ldebug) && std.allow(Ldebug, format) {
 		std.Output(2, Ldebug, fmt.Sprintf(format, v...))
 	}
 }
@@ -525,7 +598,7 @@ func Debugf(format string, v ...interface{}) {
 // if the current logging level allows that.
 // Arguments are handled in the manner of fmt.Printf.
 func Infof(format string, v ...interface{}) {
-	if std.mustLog(Linfo) {
+	if std.mustLog(Linfo) && std.allow(Linfo, format) {
 		std.Output(2, Linfo, fmt.Sprintf(format, v...))
 	}
 }
@@ -534,7 +607,7 @@ func Infof(format string, v ...interface{}) {
 // if the current logging level allows that.
 // Arguments are handled in the manner of fmt.Printf.
 func Warnf(format string, v ...interface{}) {
-	if std.mustLog(Lwarn) {
+	if std.mustLog(Lwarn) && std.allow(Lwarn, format) {
 		std.Output(2, Lwarn, fmt.Sprintf(format, v...))
 	}
 }
@@ -543,7 +616,7 @@ func Warnf(format string, v ...interface{}) {
 // if the current logging level allows that.
 // Arguments are handled in the manner of fmt.Printf.
 func Errorf(format string, v ...interface{}) {
-	if std.mustLog(Lerror) {
+	if std.mustLog(Lerror) && std.allow(Lerror, format) {
 		std.Output(2, Lerror, fmt.Sprintf(format, v...))
 	}
 }
@@ -586,20 +659,23 @@ func Errorln(v ...interface{}) {
 
 // Fatal is equivalent to Print() followed by a call to os.Exit(1).
 func Fatal(v ...interface{}) {
+	std.syncOutput()
 	std.Output(2, Lfatal, fmt.Sprint(v...))
-	os.Exit(1)
+	std.exit()
 }
 
 // Fatalf is equivalent to Printf() followed by a call to os.Exit(1).
 func Fatalf(format string, v ...interface{}) {
+	std.syncOutput()
 	std.Output(2, Lfatal, fmt.Sprintf(format, v...))
-	os.Exit(1)
+	std.exit()
 }
 
 // Fatalln is equivalent to Println() followed by a call to os.Exit(1).
 func Fatalln(v ...interface{}) {
+	std.syncOutput()
 	std.Output(2, Lfatal, fmt.Sprintln(v...))
-	os.Exit(1)
+	std.exit()
 }
 
 // Panic is equivalent to Print() followed by a call to panic().
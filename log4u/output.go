@@ -0,0 +1,271 @@
+package log4u
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// These constants define how network outputs connect.
+const (
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 5 * time.Second
+)
+
+// retryInterval defines how long a network output waits before it
+// dials an unreachable server again.
+var retryInterval = 10 * time.Second
+
+// errNotConnected is returned while a network output waits to reconnect.
+var errNotConnected = errors.New("not connected")
+
+// Entry defines a log message as passed to structured outputs.
+type Entry struct {
+	Time    time.Time
+	Level   LogLevel
+	Caller  string
+	Prefix  string
+	Message string
+	Fields  Fields
+}
+
+// EntryWriter defines a destination for log entries that keeps their
+// level and fields, such as syslog or GELF, unlike a plain writer.
+type EntryWriter interface {
+	WriteEntry(entry *Entry) error
+	Close() error
+}
+
+// AddOutput adds an output that receives every entry the logger writes.
+func (l *Logger) AddOutput(output EntryWriter) {
+	l = l.root()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.outputs = append(l.outputs, output)
+}
+
+// Outputs returns the outputs of the logger.
+func (l *Logger) Outputs() []EntryWriter {
+	l = l.root()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]EntryWriter(nil), l.outputs...)
+}
+
+// AddOutput adds an output to the standard logger.
+func AddOutput(output EntryWriter) {
+	std.AddOutput(output)
+}
+
+// writeOutputs passes an entry to the outputs of the logger.
+// The caller must hold the lock, so outputs must not block.
+func (l *Logger) writeOutputs(level LogLevel, t time.Time, method string, file string, line int, s string, fields Fields) {
+	if len(l.outputs) == 0 {
+		return
+	}
+	entry := &Entry{t, level, l.caller(method, file, line), l.prefix, s, fields}
+	for _, output := range l.outputs {
+		output.WriteEntry(entry)
+	}
+}
+
+// exit closes the outputs of the logger, which sends their queued
+// entries, and ends the program.
+func (l *Logger) exit() {
+	for _, output := range l.Outputs() {
+		output.Close()
+	}
+	os.Exit(1)
+}
+
+// AsyncOutput defines an output that queues entries and passes them to
+// another output in the background, so logging never waits for a log
+// server. The queue is bounded; entries are dropped and counted when it
+// is full or after Close.
+type AsyncOutput struct {
+	output  EntryWriter
+	queue   chan *Entry
+	flushes chan chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	state   sync.RWMutex // guards closed, so no entry is queued after Close
+	closed  bool
+	dropped uint64
+	once    sync.Once
+}
+
+// NewAsyncOutput creates an asynchronous output with a queue of the given size.
+func NewAsyncOutput(output EntryWriter, size int) *AsyncOutput {
+	o := &AsyncOutput{
+		output:  output,
+		queue:   make(chan *Entry, size),
+		flushes: make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{})}
+	go o.run()
+	return o
+}
+
+// WriteEntry queues a copy of an entry. Returns an error if the entry
+// was dropped.
+func (o *AsyncOutput) WriteEntry(entry *Entry) error {
+	o.state.RLock()
+	defer o.state.RUnlock()
+	if o.closed {
+		atomic.AddUint64(&o.dropped, 1)
+		return errors.New("log output closed, entry dropped")
+	}
+	queued := *entry
+	queued.Fields = make(Fields, len(entry.Fields))
+	for key, value := range entry.Fields {
+		queued.Fields[key] = value
+	}
+	select {
+	case o.queue <- &queued:
+		return nil
+	default:
+		atomic.AddUint64(&o.dropped, 1)
+		return errors.New("log output queue full, entry dropped")
+	}
+}
+
+// Flush waits until all queued entries are passed to the output.
+func (o *AsyncOutput) Flush() error {
+	done := make(chan struct{})
+	select {
+	case o.flushes <- done:
+		<-done
+	case <-o.stopped:
+	}
+	return nil
+}
+
+// Close passes the queued entries to the output and closes it.
+func (o *AsyncOutput) Close() error {
+	o.once.Do(func() {
+		o.state.Lock()
+		o.closed = true
+		o.state.Unlock()
+		close(o.stop)
+		<-o.stopped
+	})
+	return o.output.Close()
+}
+
+// Dropped returns the number of entries that were dropped.
+func (o *AsyncOutput) Dropped() uint64 {
+	return atomic.LoadUint64(&o.dropped)
+}
+
+func (o *AsyncOutput) run() {
+	defer close(o.stopped)
+	for {
+		select {
+		case entry := <-o.queue:
+			o.output.WriteEntry(entry)
+		case done := <-o.flushes:
+			o.drain()
+			close(done)
+		case <-o.stop:
+			o.drain()
+			return
+		}
+	}
+}
+
+// drain passes the entries that are in the queue to the output.
+func (o *AsyncOutput) drain() {
+	for {
+		select {
+		case entry := <-o.queue:
+			o.output.WriteEntry(entry)
+		default:
+			return
+		}
+	}
+}
+
+// ValidNetwork checks whether a network output can use a network.
+func ValidNetwork(network string) bool {
+	return network == "udp" || network == "tcp"
+}
+
+// netConn defines a connection to a log server that is reestablished
+// after a write fails. While the server is unreachable, dialling is
+// retried at most once per retry interval and messages are lost.
+type netConn struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	conn     net.Conn
+	lastDial time.Time
+}
+
+func newNetConn(network string, address string) *netConn {
+	return &netConn{network: network, address: address}
+}
+
+// write writes a message, reconnecting once if the connection failed.
+func (c *netConn) write(msg []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			if attempt == 0 && time.Since(c.lastDial) < retryInterval {
+				return errNotConnected
+			}
+			if err := c.dial(); err != nil {
+				return err
+			}
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := c.conn.Write(msg); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			continue
+		}
+		return nil
+	}
+	return errNotConnected
+}
+
+func (c *netConn) dial() error {
+	c.lastDial = time.Now()
+	conn, err := net.DialTimeout(c.network, c.address, dialTimeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+// close closes the connection.
+func (c *netConn) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// syslogSeverity maps a logging level to a syslog severity.
+func syslogSeverity(level LogLevel) int {
+	switch level {
+	case Ldebug:
+		return 7 // debug
+	case Linfo:
+		return 6 // informational
+	case Lwarn:
+		return 4 // warning
+	case Lerror:
+		return 3 // error
+	default:
+		return 2 // critical
+	}
+}
@@ -0,0 +1,356 @@
+package log4u
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry(message string) *Entry {
+	return &Entry{
+		Time:    time.Date(2026, 10, 18, 12, 30, 45, 123456000, time.UTC),
+		Level:   Lerror,
+		Caller:  "docsan.go:main.serve:60",
+		Message: message + "\n",
+		Fields:  Fields{keyCode: "DS1234", "request_id": `r]"1`}}
+}
+
+// acceptOne accepts a single connection in the background.
+func acceptOne(t *testing.T, listener net.Listener) <-chan net.Conn {
+	conns := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+			close(conns)
+			return
+		}
+		conns <- conn
+	}()
+	return conns
+}
+
+func receiveConn(t *testing.T, conns <-chan net.Conn) net.Conn {
+	select {
+	case conn := <-conns:
+		if conn == nil {
+			t.FailNow()
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection")
+		return nil
+	}
+}
+
+func receivePacket(t *testing.T, conn net.PacketConn) []byte {
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+// readFrame reads a syslog message framed by octet counting.
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		t.Fatalf("invalid frame length %q", length)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatal(err)
+	}
+	return string(msg)
+}
+
+func checkSyslogMessage(t *testing.T, msg string) {
+	parts := strings.SplitN(msg, " ", 7)
+	if len(parts) != 7 {
+		t.Fatalf("message %q has too few fields", msg)
+	}
+	want := []string{"<155>1", "2026-10-18T12:30:45.123456Z", headerValue(hostname(), 255), "docsan", strconv.Itoa(os.Getpid()), "DS1234"}
+	for i, field := range want {
+		if parts[i] != field {
+			t.Errorf("field %d is %q, want %q", i, parts[i], field)
+		}
+	}
+	sd := `[fields@32473 caller="docsan.go:main.serve:60" request_id="r\]\"1"] something failed`
+	if parts[6] != sd {
+		t.Errorf("structured data and message are %q, want %q", parts[6], sd)
+	}
+}
+
+func TestSyslogOverTCPIsFramedByOctetCounting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conns := acceptOne(t, listener)
+	output, err := NewSyslogOutput("tcp", listener.Addr().String(), "local3", "docsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	for i := 0; i < 2; i++ {
+		if err := output.WriteEntry(testEntry("something failed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn := receiveConn(t, conns)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		checkSyslogMessage(t, readFrame(t, r))
+	}
+}
+
+func TestSyslogOverUDPIsNotFramed(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	output, err := NewSyslogOutput("udp", listener.LocalAddr().String(), "local3", "docsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := output.WriteEntry(testEntry("something failed")); err != nil {
+		t.Fatal(err)
+	}
+	checkSyslogMessage(t, string(receivePacket(t, listener)))
+}
+
+func TestSyslogRejectsUnknownFacility(t *testing.T) {
+	if _, err := NewSyslogOutput("udp", "127.0.0.1:514", "local9", "docsan"); err == nil {
+		t.Error("facility local9 accepted")
+	}
+	if !ValidFacility("") || !ValidFacility("LOCAL7") || ValidFacility("local9") {
+		t.Error("ValidFacility disagrees with the facility names")
+	}
+}
+
+func checkGELFMessage(t *testing.T, data []byte, message string) {
+	var gelf map[string]interface{}
+	if err := json.Unmarshal(data, &gelf); err != nil {
+		t.Fatalf("invalid GELF message: %v", err)
+	}
+	want := map[string]interface{}{
+		"version":       "1.1",
+		"short_message": message,
+		"level":         3.0,
+		"timestamp":     1792326645.123,
+		"_level_name":   "ERROR",
+		"_code":         "DS1234",
+		"_request_id":   `r]"1`,
+		"_caller":       "docsan.go:main.serve:60"}
+	for key, value := range want {
+		if gelf[key] != value {
+			t.Errorf("%s is %v, want %v", key, gelf[key], value)
+		}
+	}
+}
+
+func TestGELFOverTCPIsNullTerminated(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conns := acceptOne(t, listener)
+	output, err := NewGELFOutput("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	for i := 0; i < 2; i++ {
+		if err := output.WriteEntry(testEntry("something failed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn := receiveConn(t, conns)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		msg, err := r.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGELFMessage(t, msg[:len(msg)-1], "something failed")
+	}
+}
+
+func TestGELFOverUDPChunksLargeMessages(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	output, err := NewGELFOutput("udp", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	message := strings.Repeat("x", 20000)
+	if err := output.WriteEntry(testEntry(message)); err != nil {
+		t.Fatal(err)
+	}
+	var id []byte
+	var data bytes.Buffer
+	for seq := 0; seq < 3; seq++ {
+		chunk := receivePacket(t, listener)
+		if len(chunk) > gelfChunkSize {
+			t.Errorf("chunk %d has %d bytes", seq, len(chunk))
+		}
+		if chunk[0] != 0x1e || chunk[1] != 0x0f {
+			t.Fatalf("chunk %d lacks the magic bytes", seq)
+		}
+		if id == nil {
+			id = chunk[2:10]
+		} else if !bytes.Equal(chunk[2:10], id) {
+			t.Errorf("chunk %d has message id %x, want %x", seq, chunk[2:10], id)
+		}
+		if int(chunk[10]) != seq || chunk[11] != 3 {
+			t.Fatalf("chunk %d is numbered %d of %d", seq, chunk[10], chunk[11])
+		}
+		data.Write(chunk[gelfHeaderSize:])
+	}
+	checkGELFMessage(t, data.Bytes(), message)
+}
+
+func TestGELFOverUDPSendsSmallMessagesWhole(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	output, err := NewGELFOutput("udp", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := output.WriteEntry(testEntry("something failed")); err != nil {
+		t.Fatal(err)
+	}
+	checkGELFMessage(t, receivePacket(t, listener), "something failed")
+}
+
+func TestNetworkOutputReconnects(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 0
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	conns := acceptOne(t, listener)
+	output, err := NewGELFOutput("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := output.WriteEntry(testEntry("before restart")); err != nil {
+		t.Fatal(err)
+	}
+	conn := receiveConn(t, conns)
+	if _, err := bufio.NewReader(conn).ReadBytes(0); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	listener.Close()
+
+	// the server restarts on the same address
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conns = acceptOne(t, listener)
+	// the first write after the restart may still reach the old connection
+	received := make(chan []byte, 1)
+	go func() {
+		conn, ok := <-conns
+		if !ok {
+			return
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		msg, err := bufio.NewReader(conn).ReadBytes(0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		received <- msg
+	}()
+	for i := 0; i < 50; i++ {
+		output.WriteEntry(testEntry("after restart"))
+		select {
+		case msg := <-received:
+			checkGELFMessage(t, msg[:len(msg)-1], "after restart")
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	t.Fatal("output did not reconnect")
+}
+
+// blockingOutput is an output that waits until it is released.
+type blockingOutput struct {
+	release chan struct{}
+	entries []*Entry
+}
+
+func (o *blockingOutput) WriteEntry(entry *Entry) error {
+	<-o.release
+	o.entries = append(o.entries, entry)
+	return nil
+}
+
+func (o *blockingOutput) Close() error {
+	return nil
+}
+
+func TestAsyncOutputDropsWhenFullAndSendsQueuedOnClose(t *testing.T) {
+	blocking := &blockingOutput{release: make(chan struct{})}
+	output := NewAsyncOutput(blocking, 2)
+	fields := Fields{"n": 0}
+	errors := 0
+	for i := 0; i < 10; i++ {
+		fields["n"] = i
+		if output.WriteEntry(&Entry{Message: "m", Fields: fields}) != nil {
+			errors++
+		}
+	}
+	if errors == 0 || output.Dropped() != uint64(errors) {
+		t.Errorf("%d writes failed and %d entries dropped", errors, output.Dropped())
+	}
+	close(blocking.release)
+	output.Close()
+	if len(blocking.entries)+errors != 10 {
+		t.Errorf("%d entries written and %d dropped, want 10 in total", len(blocking.entries), errors)
+	}
+	for i, entry := range blocking.entries {
+		if i > 0 && entry.Fields["n"].(int) <= blocking.entries[i-1].Fields["n"].(int) {
+			t.Errorf("entries are out of order or share their fields")
+		}
+	}
+	if output.WriteEntry(&Entry{Message: "late"}) == nil {
+		t.Error("entry accepted after Close")
+	}
+}
@@ -0,0 +1,251 @@
+package log4u
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat defines the timestamp that is appended to the name of a rotated file.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// compressSuffix defines the extension of compressed rotated files.
+const compressSuffix = ".gz"
+
+// createdSuffix defines the extension of the file that records when
+// the log file was created, as file systems do not reliably keep it.
+const createdSuffix = ".created"
+
+// RotateOptions defines when a log file is rotated and what happens to
+// the rotated files. Zero values disable the corresponding rotation.
+type RotateOptions struct {
+	MaxSize  int64         // the size in bytes at which the file is rotated
+	MaxAge   time.Duration // the time after creation at which the file is rotated
+	MaxFiles int           // the number of rotated files to retain, 0 retains all
+	Compress bool          // whether rotated files are compressed with gzip
+}
+
+// RotatingFile defines a log file that is appended to and rotated
+// when it gets too large or too old. Rotated files get the time of
+// rotation appended to their name.
+type RotatingFile struct {
+	mu       sync.Mutex
+	filename string
+	options  RotateOptions
+	file     *os.File
+	size     int64
+	created  time.Time
+	cleanup  sync.Mutex // serializes compressing and removing rotated files
+}
+
+// OpenRotatingFile opens a log file for appending, creating it if needed.
+func OpenRotatingFile(filename string, options RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{filename: filename, options: options}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write writes to the log file, rotating it first if needed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mustRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and reopens the log file. This allows external tools
+// such as logrotate to move the file away and signal docsan.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close closes the log file.
+func (f *RotatingFile) Close() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Filename returns the name of the log file.
+func (f *RotatingFile) Filename() string {
+	return f.filename
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.created = f.creationTime(info)
+	return nil
+}
+
+// creationTime gets when the log file was created. It is recorded in a
+// file next to the log file when the log file is created or first
+// opened, so that appending to the file does not reset its age.
+func (f *RotatingFile) creationTime(info os.FileInfo) time.Time {
+	if info.Size() > 0 {
+		if data, err := ioutil.ReadFile(f.filename + createdSuffix); err == nil {
+			if created, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data))); err == nil {
+				return created
+			}
+		}
+	}
+	created := f.estimateCreationTime(info)
+	ioutil.WriteFile(f.filename+createdSuffix, []byte(created.Format(time.RFC3339Nano)+"\n"), 0644)
+	return created
+}
+
+// estimateCreationTime estimates when a log file without a recorded
+// creation time was created. A file that is appended to was created
+// when the latest backup was rotated away; a file without backups is
+// at least as old as its last modification.
+func (f *RotatingFile) estimateCreationTime(info os.FileInfo) time.Time {
+	if info.Size() == 0 {
+		return time.Now()
+	}
+	if backups := f.backups(); len(backups) > 0 {
+		if latest := backups[len(backups)-1]; latest.rotated.Before(info.ModTime()) {
+			return latest.rotated
+		}
+	}
+	return info.ModTime()
+}
+
+func (f *RotatingFile) mustRotate(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.options.MaxSize > 0 && f.size+int64(n) > f.options.MaxSize {
+		return true
+	}
+	return f.options.MaxAge > 0 && time.Since(f.created) >= f.options.MaxAge
+}
+
+// rotate renames the log file, opens a new one and cleans up
+// the rotated files in the background.
+func (f *RotatingFile) rotate() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	backup := f.filename + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(f.filename, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	go f.cleanupBackups(backup)
+	return nil
+}
+
+// cleanupBackups compresses the latest rotated file if needed and
+// removes the oldest rotated files that exceed the number to retain.
+func (f *RotatingFile) cleanupBackups(latest string) {
+	f.cleanup.Lock()
+	defer f.cleanup.Unlock()
+	if f.options.Compress {
+		if err := compressFile(latest); err == nil {
+			os.Remove(latest)
+		}
+	}
+	if f.options.MaxFiles <= 0 {
+		return
+	}
+	backups := f.backups()
+	for len(backups) > f.options.MaxFiles {
+		os.Remove(backups[0].name)
+		backups = backups[1:]
+	}
+}
+
+// backup defines a file rotated by a RotatingFile.
+type backup struct {
+	name    string
+	rotated time.Time
+}
+
+// backups lists the files rotated by this writer, oldest first. Files
+// rotated by other tools, such as docsan.log.1, are left out.
+func (f *RotatingFile) backups() []backup {
+	names, err := filepath.Glob(f.filename + ".*")
+	if err != nil {
+		return nil
+	}
+	backups := make([]backup, 0, len(names))
+	for _, name := range names {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, f.filename+"."), compressSuffix)
+		if rotated, err := time.ParseInLocation(backupTimeFormat, suffix, time.Local); err == nil {
+			backups = append(backups, backup{name, rotated})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].rotated.Before(backups[j].rotated) })
+	return backups
+}
+
+// compressFile writes a gzip compressed copy of a file.
+func compressFile(filename string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	target := filename + compressSuffix
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(filename)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+	}
+	return err
+}
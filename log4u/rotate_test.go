@@ -0,0 +1,71 @@
+package log4u
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeLine(t *testing.T, f *RotatingFile, line string) {
+	if _, err := f.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotatingFileKeepsItsCreationTime(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "docsan.log")
+	f, err := OpenRotatingFile(filename, RotateOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLine(t, f, "first")
+	created := f.created
+	f.Close()
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filename, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = OpenRotatingFile(filename, RotateOptions{MaxAge: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !f.created.Equal(created) {
+		t.Errorf("reopened file created at %v, want %v", f.created, created)
+	}
+}
+
+func TestRotatingFileRotatesByAgeWithoutBackups(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "docsan.log")
+	if err := ioutil.WriteFile(filename, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now().Add(-2 * time.Hour)
+	if err := ioutil.WriteFile(filename+createdSuffix, []byte(created.Format(time.RFC3339Nano)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenRotatingFile(filename, RotateOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	writeLine(t, f, "new")
+	if backups := f.backups(); len(backups) != 1 {
+		t.Fatalf("%d rotated files, want 1", len(backups))
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new\n" {
+		t.Errorf("log file contains %q after rotation", data)
+	}
+	if time.Since(f.created) > time.Minute {
+		t.Errorf("new log file created at %v", f.created)
+	}
+	writeLine(t, f, "newer")
+	if backups := f.backups(); len(backups) != 1 {
+		t.Errorf("%d rotated files after the next write, want 1", len(backups))
+	}
+}
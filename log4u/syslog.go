@@ -0,0 +1,186 @@
+package log4u
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// syslogSDID defines the id of the structured data element that carries
+// the fields. 32473 is the private enterprise number for documentation.
+const syslogSDID = "fields@32473"
+
+// syslogTimeFormat defines the timestamp format, which allows at most microseconds.
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// nilValue defines the value of an empty syslog header field.
+const nilValue = "-"
+
+// syslogFacilities defines the syslog facilities by name.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogOutput defines an output that sends entries to a syslog server
+// in the RFC 5424 format. Over TCP messages are framed by octet counting
+// (RFC 6587). The code field, if any, is sent as message id and the
+// other fields as structured data.
+type SyslogOutput struct {
+	conn     *netConn
+	facility int
+	hostname string
+	appName  string
+	procID   string
+	framed   bool
+}
+
+// NewSyslogOutput creates a syslog output for a server at an address
+// reachable over udp or tcp. The connection is made on the first write.
+func NewSyslogOutput(network string, address string, facility string, appName string) (*SyslogOutput, error) {
+	if !ValidNetwork(network) {
+		return nil, fmt.Errorf("unsupported network %s", network)
+	}
+	code, ok := parseFacility(facility)
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %s", facility)
+	}
+	return &SyslogOutput{
+		conn:     newNetConn(network, address),
+		facility: code,
+		hostname: headerValue(hostname(), 255),
+		appName:  headerValue(appName, 48),
+		procID:   strconv.Itoa(os.Getpid()),
+		framed:   network == "tcp"}, nil
+}
+
+// ValidFacility checks whether a syslog facility name is known.
+// An empty name selects local0.
+func ValidFacility(facility string) bool {
+	_, ok := parseFacility(facility)
+	return ok
+}
+
+// parseFacility parses the name of a syslog facility.
+func parseFacility(facility string) (int, bool) {
+	if facility == "" {
+		facility = "local0"
+	}
+	code, ok := syslogFacilities[strings.ToLower(facility)]
+	return code, ok
+}
+
+// WriteEntry sends an entry to the syslog server.
+func (o *SyslogOutput) WriteEntry(entry *Entry) error {
+	msg := o.format(entry)
+	if o.framed {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	return o.conn.write(msg)
+}
+
+// Close closes the connection to the syslog server.
+func (o *SyslogOutput) Close() error {
+	return o.conn.close()
+}
+
+// format formats an entry as
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (o *SyslogOutput) format(entry *Entry) []byte {
+	msgID := nilValue
+	fields := make(Fields, len(entry.Fields)+1)
+	for key, value := range entry.Fields {
+		if key == keyCode {
+			msgID = headerValue(fmt.Sprint(value), 32)
+			continue
+		}
+		fields[key] = value
+	}
+	if entry.Caller != "" {
+		fields[keyCaller] = entry.Caller
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s ", o.facility*8+syslogSeverity(entry.Level),
+		entry.Time.Format(syslogTimeFormat), o.hostname, o.appName, o.procID, msgID)
+	b.WriteString(structuredData(fields))
+	b.WriteByte(' ')
+	b.WriteString(strings.TrimSpace(entry.Prefix + strings.TrimSuffix(entry.Message, "\n")))
+	return []byte(b.String())
+}
+
+// structuredData formats the fields as a structured data element.
+func structuredData(fields Fields) string {
+	if len(fields) == 0 {
+		return nilValue
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("[" + syslogSDID)
+	for _, key := range keys {
+		name := paramName(key)
+		if name == "" {
+			continue
+		}
+		value := fields[key]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		b.WriteString(" " + name + `="`)
+		b.WriteString(paramValueEscaper.Replace(fmt.Sprint(value)))
+		b.WriteByte('"')
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// paramValueEscaper escapes the characters that end a parameter value.
+var paramValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// paramName strips the characters a parameter name may not contain
+// and limits its length to 32 characters.
+func paramName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return -1
+		}
+		return r
+	}, key)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+// headerValue makes a value fit for a syslog header field: printable
+// ASCII without spaces, at most max characters, or the nil value.
+func headerValue(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return nilValue
+	}
+	if len(value) > max {
+		value = value[:max]
+	}
+	return value
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
+}
@@ -2,23 +2,28 @@ package node
 
 import (
 	"bytes"
-	"fmt"
 	"io"
 	"strings"
 
 	"golang.org/x/net/html"
 	a "golang.org/x/net/html/atom"
+	"ibfd.org/docsan/codes"
 	log "ibfd.org/docsan/log4u"
 )
 
 // Action defines a action tat modifies the HTML structure of a document.
 type Action struct {
 	DocID string
+	log   *log.Logger
 }
 
-// NewAction creates a document action.
-func NewAction(docID string) *Action {
-	return &Action{docID}
+// NewAction creates a document action that logs to the given logger.
+// If the logger is nil then the standard logger is used.
+func NewAction(docID string, logger *log.Logger) *Action {
+	if logger == nil {
+		logger = log.With()
+	}
+	return &Action{docID, logger}
 }
 
 // Check defines functions to filter nodes.
@@ -79,7 +84,7 @@ func replace(node *html.Node, accept Check, transform Transform) *html.Node {
 func (action *Action) DisableAttribute(node *html.Node, key string, accept Check) *html.Node {
 	nodes := FindAll(node, accept)
 	if len(nodes) > 0 {
-		action.Log(fmt.Sprintf("disabling %d %s events", len(nodes), key))
+		action.Log("disable-attribute", codes.AttributesDisabled, len(nodes), key)
 	}
 	for _, n := range nodes {
 		var found = -1
@@ -111,7 +116,7 @@ func toContent(n *html.Node) *html.Node {
 func (action *Action) AddNoticePlaceholders(node *html.Node, accept Check) *html.Node {
 	nodes := FindAll(node, accept)
 	if len(nodes) > 0 {
-		action.Log(fmt.Sprintf("adding %d notice placeholders", len(nodes)))
+		action.Log("notice-placeholders", codes.NoticePlaceholders, len(nodes))
 	}
 	for _, n := range nodes {
 		attrMap := AttrsAsMap(n)
@@ -130,7 +135,7 @@ func (action *Action) AddNoticePlaceholders(node *html.Node, accept Check) *html
 func (action *Action) AddSeeAlsoPlaceholders(node *html.Node, accept Check) *html.Node {
 	nodes := FindAll(node, accept)
 	if len(nodes) > 0 {
-		action.Log(fmt.Sprintf("adding %d seealso placeholders", len(nodes)))
+		action.Log("seealso-placeholders", codes.SeeAlsoPlaceholders, len(nodes))
 	}
 	for _, n := range nodes {
 		attrMap := AttrsAsMap(n)
@@ -160,9 +165,10 @@ func (action *Action) WrapTables(node *html.Node, accept Check) *html.Node {
 	return node
 }
 
-// Log logs an action.
-func (action *Action) Log(msg string) {
-	log.Errorf("DS1955 %s: %s", action.DocID, msg)
+// Log logs a step of an action with its message code to the logger
+// of the document.
+func (action *Action) Log(step string, code *log.Code, args ...interface{}) {
+	action.log.With("step", step).Log(code, args...)
 }
 
 func newDiv(attrs []html.Attribute) *html.Node {
@@ -333,6 +339,12 @@ func AttrNotPrefix(key, prefix string) Check {
 	return attrCheck(key, attrNot(attrPrefix(prefix)))
 }
 
+// AttrMatch returns a function that checks whether a node attribute
+// has a value that is accepted by the supplied function.
+func AttrMatch(key string, accept func(string) bool) Check {
+	return attrCheck(key, accept)
+}
+
 func attrCheck(key string, accept func(string) bool) Check {
 	return func(n *html.Node) bool {
 		for _, attr := range n.Attr {
@@ -437,3 +449,33 @@ func reparentChildren(dst, src *html.Node) {
 		dst.AppendChild(child)
 	}
 }
+
+// Text gets the concatenated text content of a node and its descendants.
+func Text(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var b bytes.Buffer
+	collectText(&b, n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// collectText writes the data of all text nodes below a node.
+func collectText(b *bytes.Buffer, n *html.Node) {
+	if n.Type == html.TextNode {
+		b.WriteString(n.Data)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		collectText(b, c)
+	}
+}
+
+// FindAncestor finds the closest ancestor of a node that is accepted.
+func FindAncestor(n *html.Node, accept Check) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if accept(p) {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package node
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	log "ibfd.org/docsan/log4u"
+)
+
+func TestActionLogsToTheDocumentLogger(t *testing.T) {
+	var out bytes.Buffer
+	root := log.New(&out, "", 0)
+	root.SetLevel("INFO")
+	logger := root.Named("render").With("docid", "doc1")
+	action := NewAction("doc1", logger)
+	disable := func() {
+		htmlDoc, err := html.Parse(strings.NewReader(`<html><body><div onclick="x()"></div></body></html>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		action.DisableAttribute(htmlDoc, "onclick", HasAttr("onclick"))
+	}
+	disable()
+	if line := out.String(); !strings.Contains(line, "DS1950") || !strings.Contains(line, "docid=doc1") || !strings.Contains(line, "step=disable-attribute") {
+		t.Errorf("logged %q", line)
+	}
+	out.Reset()
+	if err := root.SetLevels("render=WARN"); err != nil {
+		t.Fatal(err)
+	}
+	disable()
+	if out.Len() > 0 {
+		t.Errorf("logged %q above the level of the render logger", out.String())
+	}
+}
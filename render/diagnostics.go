@@ -0,0 +1,97 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+// These constants define the severities of diagnostics.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// These constants define the diagnostic codes.
+const (
+	CodeMissingDocID    = "missing-docid"
+	CodeDocIDFallback   = "docid-fallback"
+	CodeInvalidJSON     = "invalid-json"
+	CodeRepairedJSON    = "repaired-json"
+	CodeCoercedValue    = "coerced-value"
+	CodeSchemaViolation = "schema-violation"
+	CodeUntypedSection  = "untyped-section"
+	CodeInvalidMeta     = "invalid-meta"
+)
+
+// Diagnostic defines a problem found while transforming a document.
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Section  string `json:"section,omitempty"`
+	Message  string `json:"message"`
+}
+
+// HasErrors checks whether any of the diagnostics of a document is an error.
+func (document *Document) HasErrors() bool {
+	for _, d := range document.Diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// diagnose collects the diagnostics of a transformed document,
+// following the ones found while transforming it.
+func (document *Document) diagnose() []*Diagnostic {
+	diagnostics := append(make([]*Diagnostic, 0), document.diagnostics...)
+	if document.DocIDSource == "" {
+		diagnostics = append(diagnostics, &Diagnostic{SeverityError, CodeMissingDocID, "docidsource",
+			"none of the document id sources provides a document id"})
+	} else if document.DocIDSource != document.config.DocIDSources()[0] {
+		diagnostics = append(diagnostics, &Diagnostic{SeverityWarning, CodeDocIDFallback, "docidsource",
+			fmt.Sprintf("document id resolved from %s", document.DocIDSource)})
+	}
+	for _, s := range document.sections() {
+		if s.json.invalid {
+			diagnostics = append(diagnostics, &Diagnostic{SeverityError, CodeInvalidJSON, s.name,
+				fmt.Sprintf("invalid JSON replaced by %s", s.json.jtype.emptyJSON())})
+		}
+		if s.json.untyped != nil {
+			diagnostics = append(diagnostics, &Diagnostic{SeverityWarning, CodeUntypedSection, s.name,
+				fmt.Sprintf("section does not match its typed model and is not normalized: %v", s.json.untyped)})
+		}
+		if s.json.repaired {
+			diagnostics = append(diagnostics, &Diagnostic{SeverityInfo, CodeRepairedJSON, s.name,
+				"legacy script normalized to strict JSON"})
+		}
+		if len(s.json.coerced) > 0 {
+			diagnostics = append(diagnostics, &Diagnostic{SeverityWarning, CodeCoercedValue, s.name,
+				fmt.Sprintf("%s replaced by null", strings.Join(s.json.coerced, ", "))})
+		}
+	}
+	// The violations themselves are only listed under violations.
+	counts := make(map[string]int)
+	var sections []string
+	for _, v := range document.Violations {
+		if counts[v.Section] == 0 {
+			sections = append(sections, v.Section)
+		}
+		counts[v.Section]++
+	}
+	for _, section := range sections {
+		diagnostics = append(diagnostics, &Diagnostic{SeverityError, CodeSchemaViolation, section,
+			fmt.Sprintf("section violates its schema in %d places, see violations", counts[section])})
+	}
+	return diagnostics
+}
+
+// concat concatenates lists of diagnostics.
+func concat(lists ...[]*Diagnostic) []*Diagnostic {
+	var diagnostics []*Diagnostic
+	for _, list := range lists {
+		diagnostics = append(diagnostics, list...)
+	}
+	return diagnostics
+}
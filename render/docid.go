@@ -0,0 +1,106 @@
+package render
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"ibfd.org/docsan/config"
+	log "ibfd.org/docsan/log4u"
+	"ibfd.org/docsan/node"
+)
+
+// hashLength defines the number of hexadecimal digits of a content hash document id.
+const hashLength = 16
+
+// Origin defines where a document came from. It supplies the
+// request details that can be used to resolve the document id and
+// the logger that carries the context of the request.
+type Origin struct {
+	Filename string
+	Header   http.Header
+	Query    url.Values
+	Log      *log.Logger
+}
+
+// logger returns the logger of the origin or the standard logger if it has none.
+func (origin *Origin) logger() *log.Logger {
+	if origin == nil || origin.Log == nil {
+		return log.With()
+	}
+	return origin.Log
+}
+
+// resolveDocID resolves the document id by trying the configured sources
+// in order. Returns the document id and the source that provided it.
+func (df *DocumentFactory) resolveDocID(htmlDoc *html.Node, head *html.Node, origin *Origin) (string, string) {
+	if origin == nil {
+		origin = &Origin{}
+	}
+	for _, source := range df.config.DocIDSources() {
+		kind, arg := config.SplitDocIDSource(source)
+		var docID string
+		switch kind {
+		case config.DocIDSourceMeta:
+			docID = metaContent(head, arg)
+		case config.DocIDSourceCanonical:
+			docID = canonicalDocID(head)
+		case config.DocIDSourceFilename:
+			base := path.Base(strings.Replace(origin.Filename, "\\", "/", -1))
+			if origin.Filename != "" {
+				docID = strings.TrimSuffix(base, path.Ext(base))
+			}
+		case config.DocIDSourceHeader:
+			docID = origin.Header.Get(arg)
+		case config.DocIDSourceQuery:
+			docID = origin.Query.Get(arg)
+		case config.DocIDSourceHash:
+			docID = contentHash(htmlDoc)
+		}
+		if docID = strings.TrimSpace(docID); docID != "" {
+			return docID, source
+		}
+	}
+	return UnknownDocID, ""
+}
+
+// metaContent gets the content of the first meta with the given name.
+func metaContent(head *html.Node, name string) string {
+	for _, meta := range node.FindAll(head, node.Element("meta")) {
+		attrs := node.AttrsAsMap(meta)
+		if strings.EqualFold(attrs["name"], name) {
+			return attrs["content"]
+		}
+	}
+	return ""
+}
+
+// canonicalDocID gets the document id from the canonical link of a document.
+func canonicalDocID(head *html.Node) string {
+	canonical := node.FindFirst(head, node.And(node.Element("link"), node.AttrEquals("rel", "canonical")))
+	if canonical == nil {
+		return ""
+	}
+	u, err := url.Parse(strings.TrimSpace(node.AttrsAsMap(canonical)["href"]))
+	if err != nil {
+		return ""
+	}
+	if docID := docIDFromURL(u); docID != "" {
+		return docID
+	}
+	base := path.Base(u.Path)
+	if base == "/" || base == "." {
+		return ""
+	}
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// contentHash creates a document id from a hash of the document content.
+func contentHash(htmlDoc *html.Node) string {
+	sum := sha1.Sum([]byte(node.Render(htmlDoc)))
+	return "sha1-" + hex.EncodeToString(sum[:])[:hashLength]
+}
@@ -0,0 +1,39 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveDocID(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     string
+		docID    string
+		source   string
+		fallback bool
+	}{
+		{"docid meta", `<meta name="docid" content=" tt_nl ">`, "tt_nl", "meta:docid", false},
+		{"lang-free id", `<meta name="global_lang-free-id" content="cta_de">`, "cta_de", "meta:global_lang-free-id", true},
+		{"canonical", `<link rel="canonical" href="https://research.ibfd.org/linkresolver/static/tns_1">`, "tns_1", "canonical", true},
+		{"content hash", ``, "sha1-", "hash", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document := transform(t, "<html><head>"+test.head+"</head><body><p>Text</p></body></html>")
+			if !strings.HasPrefix(document.DocID, test.docID) || document.DocIDSource != test.source {
+				t.Errorf("document id %s from %s, want %s from %s", document.DocID, document.DocIDSource, test.docID, test.source)
+			}
+			fallback := false
+			for _, d := range document.Diagnostics {
+				if d.Code == CodeMissingDocID {
+					t.Errorf("unexpected diagnostic %+v", d)
+				}
+				fallback = fallback || d.Code == CodeDocIDFallback
+			}
+			if fallback != test.fallback {
+				t.Errorf("docid fallback diagnostic %t, want %t", fallback, test.fallback)
+			}
+		})
+	}
+}
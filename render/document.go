@@ -2,14 +2,22 @@ package render
 
 import (
 	"encoding/json"
+	"sort"
 	"strings"
 
 	"golang.org/x/net/html"
+	"ibfd.org/docsan/codes"
 	"ibfd.org/docsan/config"
 	log "ibfd.org/docsan/log4u"
 	"ibfd.org/docsan/node"
 )
 
+// UnknownDocID is the document id used when none of the sources provides one.
+const UnknownDocID = "unknown"
+
+// loggerName defines the name of the logger of the render package.
+const loggerName = "render"
+
 type jsonType int
 
 const (
@@ -17,16 +25,22 @@ const (
 	jsonObject
 )
 
-// JSON defines pre-rendered JSON
+// JSON defines pre-rendered JSON. The JSON is validated once when it is
+// extracted from the document; invalid JSON is replaced by an empty value.
 type JSON struct {
-	docID string
-	jtype jsonType
-	json  string
+	docID    string
+	jtype    jsonType
+	data     json.RawMessage
+	repaired bool
+	coerced  []string
+	invalid  bool
+	untyped  error
 }
 
 // DocumentFactory defines a document factory.
 type DocumentFactory struct {
 	generated                 string
+	config                    *config.Snapshot
 	outlineSelector           node.Check
 	sumtabSelector            node.Check
 	linksSelector             node.Check
@@ -43,27 +57,50 @@ type DocumentFactory struct {
 	noticePlaceholder         node.Check
 	seeAlsoPlaceholder        node.Check
 	placeholderTargetSelector node.Check
+	hyperlinkSelector         node.Check
+	jsonLDSelector            node.Check
+	microdataSelector         node.Check
+	dataIslandSelector        node.Check
 }
 
 // Document defines a document to render as JSON
 type Document struct {
-	DocID             string              `json:"-"`
-	Generated         string              `json:"generated"`
-	Title             string              `json:"title"`
-	Metas             []map[string]string `json:"metas"`
-	Outline           *JSON               `json:"outline"`
-	Sumtab            *JSON               `json:"sumtab"`
-	DocLinks          *JSON               `json:"links"`
-	SeeAlso           *JSON               `json:"seealso"`
-	Tables            *JSON               `json:"tables"`
-	Lookup            *JSON               `json:"lookup"`
-	SpecialCopyrights *JSON               `json:"specialcopyrights"`
-	Scripts           []map[string]string `json:"scripts"`
-	Body              string              `json:"body"`
-}
-
-// NewDocumentFactory creates a document factory.
+	DocID             string                 `json:"-"`
+	DocIDSource       string                 `json:"docidsource"`
+	Generated         string                 `json:"generated"`
+	Title             string                 `json:"title"`
+	Metas             []map[string]string    `json:"metas"`
+	Metadata          Metadata               `json:"metadata"`
+	Normalized        map[string]interface{} `json:"normalized"`
+	Downloads         []*Download            `json:"downloads"`
+	Structured        *Structured            `json:"structured"`
+	Outline           *JSON                  `json:"outline"`
+	OutlineSource     string                 `json:"outlinesource"`
+	Sumtab            *JSON                  `json:"sumtab"`
+	DocLinks          *JSON                  `json:"links"`
+	SeeAlso           *JSON                  `json:"seealso"`
+	Tables            *JSON                  `json:"tables"`
+	Lookup            *JSON                  `json:"lookup"`
+	SpecialCopyrights *JSON                  `json:"specialcopyrights"`
+	Toc               *JSON                  `json:"toc"`
+	Data              map[string]*JSON       `json:"data"`
+	Repaired          []string               `json:"repaired,omitempty"`
+	Violations        []*Violation           `json:"violations,omitempty"`
+	Diagnostics       []*Diagnostic          `json:"diagnostics"`
+	Hyperlinks        []*Hyperlink           `json:"hyperlinks"`
+	Scripts           []map[string]string    `json:"scripts"`
+	Body              string                 `json:"body"`
+	anchors           map[string]bool
+	diagnostics       []*Diagnostic
+	log               *log.Logger
+	config            *config.Snapshot
+}
+
+// NewDocumentFactory creates a document factory for the current config.
+// The factory keeps using that config; create a new factory after the
+// config is reloaded.
 func NewDocumentFactory(appName string) *DocumentFactory {
+	snapshot := config.Current()
 	scriptSelector := node.Element("script")
 	outLineAttrChecker := node.AttrEquals("id", "outline")
 	sumtabAttrChecker := node.AttrEquals("id", "sumtab")
@@ -73,10 +110,16 @@ func NewDocumentFactory(appName string) *DocumentFactory {
 	lookupAttrChecker := node.AttrEquals("id", "lookup")
 	tocAttrChecker := node.AttrEquals("id", "script_toc")
 	specialCopyrightsAttrChecker := node.AttrEquals("id", "specialcopyrights")
-	scriptsToDeleteSelector := node.And(scriptSelector, node.Or(outLineAttrChecker, sumtabAttrChecker,
-		linksAttrChecker, refsAttrChecker, tablesAttrChecker, lookupAttrChecker, tocAttrChecker, specialCopyrightsAttrChecker))
+	jsonLDAttrChecker := node.AttrEquals("type", "application/ld+json")
+	knownIDAttrChecker := node.Or(outLineAttrChecker, sumtabAttrChecker, linksAttrChecker, refsAttrChecker,
+		tablesAttrChecker, lookupAttrChecker, tocAttrChecker, specialCopyrightsAttrChecker)
+	dataIslandSelector := node.And(scriptSelector, node.AttrEquals("type", "application/json"), node.HasAttr("id"),
+		node.Not(knownIDAttrChecker), node.Not(node.AttrMatch("id", snapshot.DataIslandExclude())))
+	scriptsToDeleteSelector := node.Or(node.And(scriptSelector, node.Or(knownIDAttrChecker, jsonLDAttrChecker)),
+		dataIslandSelector)
 	return &DocumentFactory{
 		generated:                 appName,
+		config:                    snapshot,
 		outlineSelector:           node.And(scriptSelector, outLineAttrChecker),
 		sumtabSelector:            node.And(scriptSelector, sumtabAttrChecker),
 		linksSelector:             node.And(scriptSelector, linksAttrChecker),
@@ -92,29 +135,70 @@ func NewDocumentFactory(appName string) *DocumentFactory {
 		disableAtributeSelector:   disableAtributeSelector(),
 		noticePlaceholder:         noticePlaceholder(),
 		seeAlsoPlaceholder:        seeAlsoPlaceholder(),
-		placeholderTargetSelector: placeholderTargetSelector()}
+		placeholderTargetSelector: placeholderTargetSelector(),
+		hyperlinkSelector:         hyperlinkSelector(),
+		jsonLDSelector:            jsonLDSelector(),
+		microdataSelector:         microdataSelector(),
+		dataIslandSelector:        dataIslandSelector}
+}
+
+// Config returns the config the factory uses.
+func (df *DocumentFactory) Config() *config.Snapshot {
+	return df.config
 }
 
 // Transform transforms a HTML node to a document structure for JSON output.
 func (df *DocumentFactory) Transform(htmlDoc *html.Node) *Document {
+	return df.TransformFrom(htmlDoc, nil)
+}
+
+// TransformFrom transforms a HTML node to a document structure for JSON output.
+// The origin of the document is used to resolve its document id.
+func (df *DocumentFactory) TransformFrom(htmlDoc *html.Node, origin *Origin) *Document {
 	head := node.FindFirst(htmlDoc, node.Element("head"))
-	metas := toMetas(node.FindAll(head, node.Element("meta")))
-	docID := getDocID(metas)
-	action := node.NewAction(docID)
-	return &Document{
+	docID, docIDSource := df.resolveDocID(htmlDoc, head, origin)
+	metas := df.toMetas(node.FindAll(head, node.Element("meta")))
+	metadata := toMetadata(metas)
+	normalized, metaDiagnostics := df.normalizeMetadata(metadata)
+	downloads, downloadDiagnostics := df.toDownloads(metadata)
+	structured, structuredDiagnostics := df.toStructured(htmlDoc, head)
+	logger := origin.logger().Named(loggerName).With("docid", docID)
+	action := node.NewAction(docID, logger)
+	outline, outlineSource := df.toOutline(htmlDoc, docID, logger)
+	document := &Document{
 		DocID:             docID,
+		DocIDSource:       docIDSource,
 		Generated:         df.generated,
 		Title:             node.Content(node.FindFirst(head, node.Element("title"))),
 		Metas:             metas,
-		Outline:           formatJSON(node.FindFirst(htmlDoc, df.outlineSelector), docID, jsonObject),
-		Sumtab:            formatJSON(node.FindFirst(htmlDoc, df.sumtabSelector), docID, jsonObject),
-		DocLinks:          formatJSON(node.FindFirst(htmlDoc, df.linksSelector), docID, jsonObject),
-		SeeAlso:           formatJSON(node.FindFirst(htmlDoc, df.refsSelector), docID, jsonObject),
-		Tables:            formatJSON(node.FindFirst(htmlDoc, df.tablesSelector), docID, jsonArray),
-		Lookup:            formatJSON(node.FindFirst(htmlDoc, df.lookupSelector), docID, jsonArray),
-		SpecialCopyrights: formatJSON(node.FindFirst(htmlDoc, df.specialCopyrightsSelector), docID, jsonObject),
+		Metadata:          metadata,
+		Normalized:        normalized,
+		Downloads:         downloads,
+		Structured:        structured,
+		Outline:           outline,
+		OutlineSource:     outlineSource,
+		Sumtab:            formatJSON(node.FindFirst(htmlDoc, df.sumtabSelector), docID, jsonObject, logger),
+		DocLinks:          formatJSON(node.FindFirst(htmlDoc, df.linksSelector), docID, jsonObject, logger),
+		SeeAlso:           formatJSON(node.FindFirst(htmlDoc, df.refsSelector), docID, jsonObject, logger),
+		Tables:            formatJSON(node.FindFirst(htmlDoc, df.tablesSelector), docID, jsonArray, logger),
+		Lookup:            formatJSON(node.FindFirst(htmlDoc, df.lookupSelector), docID, jsonArray, logger),
+		SpecialCopyrights: formatJSON(node.FindFirst(htmlDoc, df.specialCopyrightsSelector), docID, jsonObject, logger),
+		Toc:               formatJSON(node.FindFirst(htmlDoc, df.tocSelector), docID, jsonObject, logger),
+		Data:              df.toData(htmlDoc, docID, logger),
+		Hyperlinks:        df.toHyperlinks(htmlDoc),
+		anchors:           toAnchors(htmlDoc),
 		Scripts:           node.ToMapArray(node.FindAll(head, df.scriptsToKeepSelector)),
-		Body:              df.renderBody(htmlDoc, action)}
+		Body:              df.renderBody(htmlDoc, action),
+		diagnostics:       concat(metaDiagnostics, downloadDiagnostics, structuredDiagnostics),
+		log:               logger,
+		config:            df.config}
+	document.Repaired = document.repairedSections()
+	if df.config.TypedSections() {
+		document.normalizeSections()
+	}
+	document.Violations = document.validateSections()
+	document.Diagnostics = document.diagnose()
+	return document
 }
 
 func (df *DocumentFactory) renderBody(htmlDoc *html.Node, action *node.Action) string {
@@ -128,31 +212,9 @@ func (df *DocumentFactory) renderBody(htmlDoc *html.Node, action *node.Action) s
 	return node.RenderChildren(body7)
 }
 
-// ToJSON renders a document to JSON.
-func (document *Document) ToJSON() ([]byte, error) {
-	if config.JSONPretty() {
-		return json.MarshalIndent(document, "", "  ")
-	} else {
-		return json.Marshal(document)
-	}
-}
-
 // MarshalJSON marshals a pre-rendered JSON object
 func (j JSON) MarshalJSON() ([]byte, error) {
-	test := `{"data":` + j.json + "}"
-	var result map[string]interface{}
-	err := json.Unmarshal([]byte(test), &result)
-	if err != nil {
-		log.Errorf("invalid JSON in %s ignored: %s", j.docID, strings.TrimSpace(j.json))
-		return []byte(j.jtype.emptyJSON()), nil
-	}
-	return []byte(j.json), nil
-}
-
-func toMetas(nodes []*html.Node) []map[string]string {
-	metaNameAccept := metaAccept(config.MetaNameAccept())
-	metas := node.ToMapArrayFiltered(nodes, metaNameAccept)
-	return metas
+	return j.data, nil
 }
 
 func commentTargetSelector() node.Check {
@@ -214,30 +276,91 @@ func chapterTableSelector() node.Check {
 	return node.And(isTable, isChapterType)
 }
 
-func metaAccept(acceptMetaName func(string) bool) node.CheckAttrs {
-	return func(attrs map[string]string) bool {
-		name, present := attrs["name"]
-		return !present || acceptMetaName(name)
+// toData collects the JSON data islands that have no dedicated
+// section, keyed by id. A script with a repeated id is ignored.
+func (df *DocumentFactory) toData(htmlDoc *html.Node, docID string, logger *log.Logger) map[string]*JSON {
+	data := make(map[string]*JSON)
+	for _, n := range node.FindAll(htmlDoc, df.dataIslandSelector) {
+		id := node.AttrsAsMap(n)["id"]
+		if _, present := data[id]; !present {
+			data[id] = formatJSON(n, docID, guessJSONType(n), logger)
+		}
 	}
+	return data
 }
 
-func getDocID(metas []map[string]string) string {
-	for _, meta := range metas {
-		if strings.EqualFold(meta["name"], "docid") {
-			return meta["content"]
-		}
+// guessJSONType determines the type of JSON in a script from its first character.
+func guessJSONType(n *html.Node) jsonType {
+	if n.FirstChild != nil && strings.HasPrefix(strings.TrimSpace(n.FirstChild.Data), "[") {
+		return jsonArray
+	}
+	return jsonObject
+}
+
+// formatJSON gets the pre-rendered JSON from a data script.
+// Legacy scripts that are not strict JSON are normalized; invalid
+// JSON is logged with the logger of the document.
+func formatJSON(n *html.Node, docID string, jtype jsonType, logger *log.Logger) *JSON {
+	if n == nil || n.FirstChild == nil {
+		return newJSON(docID, jtype, jtype.emptyJSON())
 	}
-	return "unknown"
+	data, repaired, coerced := normalizeJSON(n.FirstChild.Data)
+	if !json.Valid([]byte(data)) {
+		logger.Log(codes.InvalidJSON, docID, log.Snippet(strings.TrimSpace(data)))
+		j := newJSON(docID, jtype, jtype.emptyJSON())
+		j.invalid = true
+		return j
+	}
+	j := newJSON(docID, jtype, data)
+	j.repaired = repaired
+	j.coerced = coerced
+	return j
+}
+
+func newJSON(docID string, jtype jsonType, data string) *JSON {
+	return &JSON{docID: docID, jtype: jtype, data: json.RawMessage(data)}
 }
 
-func formatJSON(n *html.Node, docID string, jtype jsonType) *JSON {
-	var data string
-	if n == nil {
-		data = jtype.emptyJSON()
-	} else {
-		data = n.FirstChild.Data
+// section defines a named pre-rendered JSON section of a document.
+type section struct {
+	name string
+	json *JSON
+}
+
+// sections returns the pre-rendered JSON sections of a document.
+// Data islands are named data.<id>.
+func (document *Document) sections() []section {
+	sections := []section{
+		{"outline", document.Outline},
+		{"sumtab", document.Sumtab},
+		{"links", document.DocLinks},
+		{"seealso", document.SeeAlso},
+		{"tables", document.Tables},
+		{"lookup", document.Lookup},
+		{"specialcopyrights", document.SpecialCopyrights},
+		{"toc", document.Toc},
+	}
+	ids := make([]string, 0, len(document.Data))
+	for id := range document.Data {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		sections = append(sections, section{"data." + id, document.Data[id]})
+	}
+	return sections
+}
+
+// repairedSections returns the names of the sections
+// that had to be normalized to strict JSON.
+func (document *Document) repairedSections() []string {
+	var repaired []string
+	for _, s := range document.sections() {
+		if s.json.repaired {
+			repaired = append(repaired, s.name)
+		}
 	}
-	return &JSON{docID, jtype, data}
+	return repaired
 }
 
 func (jtype jsonType) emptyJSON() string {
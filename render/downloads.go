@@ -0,0 +1,61 @@
+package render
+
+import (
+	"fmt"
+	"net/url"
+
+	"ibfd.org/docsan/config"
+)
+
+// Download defines an alternative rendition of a document.
+type Download struct {
+	Format string `json:"format"`
+	Scope  string `json:"scope,omitempty"`
+	URL    string `json:"url"`
+	Meta   string `json:"meta"`
+}
+
+// toDownloads lists the alternative renditions described by the metas
+// of a document, following the configured download rules.
+func (df *DocumentFactory) toDownloads(metadata Metadata) ([]*Download, []*Diagnostic) {
+	downloads := make([]*Download, 0)
+	var diagnostics []*Diagnostic
+	for _, rule := range df.config.DownloadRules() {
+		for _, value := range metaValues(metadata[rule.Meta]) {
+			if value == "" {
+				continue
+			}
+			resolved, err := resolveDownloadURL(value, df.downloadBase(rule))
+			if err != nil {
+				diagnostics = append(diagnostics, &Diagnostic{SeverityWarning, CodeInvalidMeta, "downloads",
+					fmt.Sprintf("%s: %v", rule.Meta, err)})
+				continue
+			}
+			downloads = append(downloads, &Download{rule.Format, rule.Scope, resolved, rule.Meta})
+		}
+	}
+	return downloads, diagnostics
+}
+
+// resolveDownloadURL resolves the URL of a download. Without
+// a base URL relative URLs are returned as they are.
+func resolveDownloadURL(value string, base string) (string, error) {
+	if base == "" {
+		if _, err := url.Parse(value); err != nil {
+			return "", fmt.Errorf("invalid URL %q", value)
+		}
+		return value, nil
+	}
+	return normalizeURL(value, base)
+}
+
+// downloadBase gets the base URL to resolve the URL of a download against.
+func (df *DocumentFactory) downloadBase(rule *config.DownloadRule) string {
+	if rule.Base != "" {
+		return rule.Base
+	}
+	if metaType, present := df.config.MetaTypes()[rule.Meta]; present && metaType.Type == config.MetaTypeURL {
+		return metaType.Base
+	}
+	return ""
+}
@@ -0,0 +1,199 @@
+package render
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"ibfd.org/docsan/node"
+)
+
+// These constants define the kinds of hyperlinks.
+const (
+	LinkInternal = "internal"
+	LinkDocument = "document"
+	LinkExternal = "external"
+)
+
+// documentExtensions defines the extensions of the files that hold documents.
+var documentExtensions = map[string]bool{".html": true, ".htm": true}
+
+// linkResolverPath is the path prefix of IBFD cross-document links.
+const linkResolverPath = "/linkresolver/static/"
+
+// Hyperlink defines an anchor found in the document body.
+type Hyperlink struct {
+	Href        string `json:"href"`
+	Text        string `json:"text"`
+	Kind        string `json:"kind"`
+	DocID       string `json:"docid,omitempty"`
+	Fragment    string `json:"fragment,omitempty"`
+	Annotatable string `json:"annotatable,omitempty"`
+}
+
+// toHyperlinks creates the link inventory of the document body.
+func (df *DocumentFactory) toHyperlinks(htmlDoc *html.Node) []*Hyperlink {
+	body := node.FindFirst(htmlDoc, node.Element("body"))
+	anchors := node.FindAll(body, df.hyperlinkSelector)
+	links := make([]*Hyperlink, 0, len(anchors))
+	for _, a := range anchors {
+		href := strings.TrimSpace(node.AttrsAsMap(a)["href"])
+		link := newHyperlink(href)
+		link.Text = node.Text(a)
+		if annotatable := node.FindAncestor(a, df.placeholderTargetSelector); annotatable != nil {
+			link.Annotatable = node.AttrsAsMap(annotatable)["id"]
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// newHyperlink classifies a link by its href. Links that refer to
+// neither a fragment of the document nor another document, such as
+// links to images or downloads, are external.
+func newHyperlink(href string) *Hyperlink {
+	link := &Hyperlink{Href: href, Kind: LinkExternal}
+	if strings.HasPrefix(href, "#") {
+		link.Kind = LinkInternal
+		link.Fragment = href[1:]
+		return link
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return link
+	}
+	if docID := docIDFromURL(u); docID != "" {
+		link.Kind = LinkDocument
+		link.DocID = docID
+		link.Fragment = u.Fragment
+	}
+	return link
+}
+
+// docIDFromURL resolves the document id a URL refers to. Relative URLs
+// refer to a document only if they point at a document file.
+// Returns an empty string if the URL does not refer to a document.
+func docIDFromURL(u *url.URL) string {
+	if docID := u.Query().Get("docid"); docID != "" {
+		return docID
+	}
+	if i := strings.Index(u.Path, linkResolverPath); i >= 0 {
+		return strings.Trim(u.Path[i+len(linkResolverPath):], "/")
+	}
+	if u.Scheme == "" && u.Host == "" && IsDocumentPath(u.Path) {
+		base := path.Base(u.Path)
+		return strings.TrimSuffix(base, path.Ext(base))
+	}
+	return ""
+}
+
+// IsDocumentPath checks whether a path has the extension of a document file.
+func IsDocumentPath(p string) bool {
+	return documentExtensions[strings.ToLower(path.Ext(p))]
+}
+
+func hyperlinkSelector() node.Check {
+	return node.And(node.Element("a"), node.HasAttr("href"))
+}
+
+// toAnchors collects the ids of all possible link targets in the document body.
+func toAnchors(htmlDoc *html.Node) map[string]bool {
+	body := node.FindFirst(htmlDoc, node.Element("body"))
+	anchors := make(map[string]bool)
+	for _, n := range node.FindAll(body, node.Or(node.HasAttr("id"), node.And(node.Element("a"), node.HasAttr("name")))) {
+		attrs := node.AttrsAsMap(n)
+		if id, present := attrs["id"]; present {
+			anchors[id] = true
+		}
+		if name, present := attrs["name"]; present {
+			anchors[name] = true
+		}
+	}
+	return anchors
+}
+
+// HasAnchor checks whether the document body contains a link target.
+func (document *Document) HasAnchor(id string) bool {
+	return document.anchors[id]
+}
+
+// LinkIndex defines the links of a document and the anchors they can
+// refer to, without the rest of the document.
+type LinkIndex struct {
+	DocID          string
+	Hyperlinks     []*Hyperlink
+	OutlineTargets []string
+	TocTargets     []string
+	anchors        map[string]bool
+}
+
+// LinkIndex returns the link index of the document.
+func (document *Document) LinkIndex() *LinkIndex {
+	return &LinkIndex{
+		DocID:          document.DocID,
+		Hyperlinks:     document.Hyperlinks,
+		OutlineTargets: document.OutlineTargets(),
+		TocTargets:     document.TocTargets(),
+		anchors:        document.anchors}
+}
+
+// HasAnchor checks whether the document body contains a link target.
+func (index *LinkIndex) HasAnchor(id string) bool {
+	return index.anchors[id]
+}
+
+// OutlineTargets returns the anchors the entries of the outline refer to.
+func (document *Document) OutlineTargets() []string {
+	return document.Outline.targets()
+}
+
+// TocTargets returns the anchors the entries of the table of contents refer to.
+func (document *Document) TocTargets() []string {
+	return document.Toc.targets()
+}
+
+// targets collects the anchors referred to by the pre-rendered JSON.
+// Entries refer to anchors by an "id", "anchor" or "target" property
+// or by a fragment "href".
+func (j *JSON) targets() []string {
+	var data interface{}
+	if j == nil || json.Unmarshal(j.data, &data) != nil {
+		return nil
+	}
+	targets := make([]string, 0, 32)
+	collectTargets(data, &targets)
+	return targets
+}
+
+func collectTargets(data interface{}, targets *[]string) {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			collectTargets(item, targets)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := v[key]
+			if str, ok := value.(string); ok && str != "" {
+				switch key {
+				case "id", "anchor", "target":
+					*targets = append(*targets, strings.TrimPrefix(str, "#"))
+				case "href":
+					if strings.HasPrefix(str, "#") && len(str) > 1 {
+						*targets = append(*targets, str[1:])
+					}
+				}
+			} else {
+				collectTargets(value, targets)
+			}
+		}
+	}
+}
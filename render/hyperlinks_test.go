@@ -0,0 +1,66 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// transform transforms an HTML document with the default config.
+func transform(t *testing.T, source string) *Document {
+	htmlDoc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDocumentFactory("test").Transform(htmlDoc)
+}
+
+func TestNewHyperlinkClassifiesLinks(t *testing.T) {
+	tests := []struct {
+		href     string
+		kind     string
+		docID    string
+		fragment string
+	}{
+		{"#", LinkInternal, "", ""},
+		{"#section-2", LinkInternal, "", "section-2"},
+		{"?docid=tt_nl_2020#p3", LinkDocument, "tt_nl_2020", "p3"},
+		{"https://research.ibfd.org/viewer?docid=cta_de#s1", LinkDocument, "cta_de", "s1"},
+		{"https://research.ibfd.org/linkresolver/static/tns_2021-01-01_nl_1#para2", LinkDocument, "tns_2021-01-01_nl_1", "para2"},
+		{"/linkresolver/static/tt_be/", LinkDocument, "tt_be", ""},
+		{"other.html#top", LinkDocument, "other", "top"},
+		{"../chapters/Chapter-2.HTM", LinkDocument, "Chapter-2", ""},
+		{"images/chart.png", LinkExternal, "", ""},
+		{"downloads/report.pdf", LinkExternal, "", ""},
+		{"https://www.oecd.org/tax/", LinkExternal, "", ""},
+		{"mailto:support@ibfd.org", LinkExternal, "", ""},
+	}
+	for _, test := range tests {
+		link := newHyperlink(test.href)
+		if link.Kind != test.kind || link.DocID != test.docID || link.Fragment != test.fragment {
+			t.Errorf("%s classified as %s %q #%q, want %s %q #%q", test.href,
+				link.Kind, link.DocID, link.Fragment, test.kind, test.docID, test.fragment)
+		}
+	}
+}
+
+func TestHyperlinksKeepTextAndAnnotatable(t *testing.T) {
+	document := transform(t, `<html><body>
+		<p class="annotatable" id="p1">See <a href="#p2">below</a>.</p>
+		<p id="p2"><a href=" other.htm ">Other</a> <a>no href</a></p>
+		</body></html>`)
+	if len(document.Hyperlinks) != 2 {
+		t.Fatalf("%d hyperlinks found, want 2", len(document.Hyperlinks))
+	}
+	first, second := document.Hyperlinks[0], document.Hyperlinks[1]
+	if first.Kind != LinkInternal || first.Text != "below" || first.Annotatable != "p1" {
+		t.Errorf("first link is %+v", first)
+	}
+	if second.Kind != LinkDocument || second.Href != "other.htm" || second.DocID != "other" || second.Annotatable != "" {
+		t.Errorf("second link is %+v", second)
+	}
+	if !document.HasAnchor("p2") || document.HasAnchor("p3") {
+		t.Error("anchors do not match the ids in the body")
+	}
+}
@@ -0,0 +1,421 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// jsLiteralParser parses the subset of JavaScript literals used by legacy
+// data scripts and writes it as strict JSON. Apart from strict JSON it
+// accepts single quoted and template strings, unquoted keys, trailing commas,
+// comments, undefined, NaN, Infinity and hexadecimal numbers.
+type jsLiteralParser struct {
+	src     []rune
+	pos     int
+	out     bytes.Buffer
+	coerced []string
+}
+
+// assignmentPrefix matches a JavaScript assignment before the data, such
+// as 'var toc = ', 'window.toc =' or 'data["toc"] ='. The = must not be
+// part of a comparison.
+var assignmentPrefix = regexp.MustCompile(`^((?:(?:var|let|const)\s+)?[A-Za-z_$][\w$]*` +
+	`(?:\s*\.\s*[A-Za-z_$][\w$]*|\s*\[\s*(?:"[^"]*"|'[^']*'|\d+)\s*\])*\s*=)(?:[^=]|$)`)
+
+// normalizeJSON extracts the data from a legacy data script and normalizes
+// it to strict JSON. Returns the data, whether a repair was needed and
+// the values, such as NaN, that were replaced by null.
+// If the data cannot be parsed then it is returned unmodified.
+func normalizeJSON(script string) (string, bool, []string) {
+	trimmed := strings.TrimSpace(script)
+	data := stripAssignment(trimmed)
+	if json.Valid([]byte(data)) {
+		return data, data != trimmed, nil
+	}
+	p := &jsLiteralParser{src: []rune(data)}
+	if err := p.parse(); err != nil {
+		return script, false, nil
+	}
+	return p.out.String(), true, p.coerced
+}
+
+// stripAssignment strips a JavaScript assignment, such as 'var toc = ',
+// and the terminating semicolon from a script.
+func stripAssignment(script string) string {
+	data := strings.TrimSpace(script)
+	match := assignmentPrefix.FindStringSubmatchIndex(data)
+	if match == nil {
+		return data
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(data[match[3]:]), ";"))
+}
+
+func (p *jsLiteralParser) parse() error {
+	if err := p.value(); err != nil {
+		return err
+	}
+	p.skipSpace()
+	for p.pos < len(p.src) && p.src[p.pos] == ';' {
+		p.pos++
+		p.skipSpace()
+	}
+	if p.pos < len(p.src) {
+		return p.errorf("unexpected %q after value", p.src[p.pos])
+	}
+	return nil
+}
+
+func (p *jsLiteralParser) value() error {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return p.errorf("unexpected end of data")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"' || c == '\'' || c == '`':
+		str, err := p.str()
+		if err != nil {
+			return err
+		}
+		p.writeString(str)
+		return nil
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	case isIdentStart(c):
+		return p.keyword()
+	default:
+		return p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *jsLiteralParser) object() error {
+	p.pos++
+	p.out.WriteByte('{')
+	first := true
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return p.errorf("unterminated object")
+		}
+		if p.src[p.pos] == '}' {
+			p.pos++
+			p.out.WriteByte('}')
+			return nil
+		}
+		if !first {
+			p.out.WriteByte(',')
+		}
+		first = false
+		if err := p.key(); err != nil {
+			return err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] != ':' {
+			return p.errorf("expected ':'")
+		}
+		p.pos++
+		p.out.WriteByte(':')
+		if err := p.value(); err != nil {
+			return err
+		}
+		if err := p.separator('}'); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *jsLiteralParser) array() error {
+	p.pos++
+	p.out.WriteByte('[')
+	first := true
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return p.errorf("unterminated array")
+		}
+		if p.src[p.pos] == ']' {
+			p.pos++
+			p.out.WriteByte(']')
+			return nil
+		}
+		if !first {
+			p.out.WriteByte(',')
+		}
+		first = false
+		if err := p.value(); err != nil {
+			return err
+		}
+		if err := p.separator(']'); err != nil {
+			return err
+		}
+	}
+}
+
+// separator consumes the comma after an object member or array element.
+// The closing character is left for the caller, which allows trailing commas.
+func (p *jsLiteralParser) separator(end rune) error {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return p.errorf("unexpected end of data")
+	}
+	switch p.src[p.pos] {
+	case ',':
+		p.pos++
+		return nil
+	case end:
+		return nil
+	default:
+		return p.errorf("expected ',' or %q", end)
+	}
+}
+
+func (p *jsLiteralParser) key() error {
+	c := p.src[p.pos]
+	if c == '"' || c == '\'' || c == '`' {
+		str, err := p.str()
+		if err != nil {
+			return err
+		}
+		p.writeString(str)
+		return nil
+	}
+	if !isIdentStart(c) && !unicode.IsDigit(c) {
+		return p.errorf("invalid key start %q", c)
+	}
+	start := p.pos
+	for p.pos < len(p.src) && (isIdentStart(p.src[p.pos]) || unicode.IsDigit(p.src[p.pos])) {
+		p.pos++
+	}
+	p.writeString(string(p.src[start:p.pos]))
+	return nil
+}
+
+func (p *jsLiteralParser) keyword() error {
+	start := p.pos
+	for p.pos < len(p.src) && (isIdentStart(p.src[p.pos]) || unicode.IsDigit(p.src[p.pos])) {
+		p.pos++
+	}
+	switch word := string(p.src[start:p.pos]); word {
+	case "true", "false", "null":
+		p.out.WriteString(word)
+	case "undefined", "NaN", "Infinity":
+		p.coerce(word)
+	default:
+		return p.errorf("unexpected identifier %s", word)
+	}
+	return nil
+}
+
+func (p *jsLiteralParser) number() error {
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+		p.pos++
+	}
+	if strings.HasPrefix(string(p.src[p.pos:]), "Infinity") {
+		p.pos += len("Infinity")
+		p.coerce(string(p.src[start:p.pos]))
+		return nil
+	}
+	for p.pos < len(p.src) && strings.ContainsRune("+-.0123456789abcdefABCDEFxX", p.src[p.pos]) {
+		p.pos++
+	}
+	token := string(p.src[start:p.pos])
+	if json.Valid([]byte(token)) {
+		p.out.WriteString(token)
+		return nil
+	}
+	unsigned := strings.TrimLeft(token, "+-")
+	negative := strings.HasPrefix(token, "-")
+	if strings.HasPrefix(unsigned, "0x") || strings.HasPrefix(unsigned, "0X") {
+		i, err := strconv.ParseInt(unsigned[2:], 16, 64)
+		if err != nil {
+			return p.errorf("invalid number %s", token)
+		}
+		if negative {
+			i = -i
+		}
+		p.out.WriteString(strconv.FormatInt(i, 10))
+		return nil
+	}
+	f, err := strconv.ParseFloat(strings.TrimPrefix(token, "+"), 64)
+	if err != nil {
+		return p.errorf("invalid number %s", token)
+	}
+	p.out.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	return nil
+}
+
+// str parses a quoted string and returns its value.
+func (p *jsLiteralParser) str() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		case c == '\n' && quote != '`':
+			return "", p.errorf("unterminated string")
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *jsLiteralParser) escape(b *strings.Builder) error {
+	if p.pos >= len(p.src) {
+		return p.errorf("unterminated escape")
+	}
+	c := p.src[p.pos]
+	p.pos++
+	switch c {
+	case 'n':
+		b.WriteByte('\n')
+	case 't':
+		b.WriteByte('\t')
+	case 'r':
+		b.WriteByte('\r')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'v':
+		b.WriteByte('\v')
+	case '0':
+		b.WriteByte(0)
+	case '\n':
+		// line continuation
+	case 'x':
+		return p.hexEscape(b, 2)
+	case 'u':
+		if p.pos < len(p.src) && p.src[p.pos] == '{' {
+			end := p.find("}")
+			if end < 0 {
+				return p.errorf("unterminated unicode escape")
+			}
+			r, err := strconv.ParseUint(string(p.src[p.pos+1:end]), 16, 32)
+			if err != nil {
+				return p.errorf("invalid unicode escape")
+			}
+			p.pos = end + 1
+			b.WriteRune(rune(r))
+			return nil
+		}
+		return p.utf16Escape(b)
+	default:
+		b.WriteRune(c)
+	}
+	return nil
+}
+
+// utf16Escape decodes a \uXXXX escape, combining surrogate pairs.
+func (p *jsLiteralParser) utf16Escape(b *strings.Builder) error {
+	r, err := p.hex(4)
+	if err != nil {
+		return err
+	}
+	if utf16.IsSurrogate(r) && p.pos+6 <= len(p.src) && p.src[p.pos] == '\\' && p.src[p.pos+1] == 'u' {
+		p.pos += 2
+		low, err := p.hex(4)
+		if err != nil {
+			return err
+		}
+		r = utf16.DecodeRune(r, low)
+	}
+	b.WriteRune(r)
+	return nil
+}
+
+func (p *jsLiteralParser) hexEscape(b *strings.Builder, n int) error {
+	r, err := p.hex(n)
+	if err != nil {
+		return err
+	}
+	b.WriteRune(r)
+	return nil
+}
+
+// hex parses n hexadecimal digits.
+func (p *jsLiteralParser) hex(n int) (rune, error) {
+	if p.pos+n > len(p.src) {
+		return 0, p.errorf("invalid escape")
+	}
+	r, err := strconv.ParseUint(string(p.src[p.pos:p.pos+n]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid escape")
+	}
+	p.pos += n
+	return rune(r), nil
+}
+
+// coerce writes null for a value that has no JSON equivalent.
+func (p *jsLiteralParser) coerce(value string) {
+	p.out.WriteString("null")
+	p.coerced = append(p.coerced, value)
+}
+
+func (p *jsLiteralParser) writeString(str string) {
+	data, _ := json.Marshal(str)
+	p.out.Write(data)
+}
+
+// skipSpace skips white space and comments.
+func (p *jsLiteralParser) skipSpace() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case unicode.IsSpace(c):
+			p.pos++
+		case c == '/' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '/':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '/' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '*':
+			p.pos += 2
+			end := p.find("*/")
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos = end + 2
+			}
+		default:
+			return
+		}
+	}
+}
+
+// find returns the index of the first occurrence of str
+// at or after the current position, or -1 if not found.
+func (p *jsLiteralParser) find(str string) int {
+	target := []rune(str)
+	for i := p.pos; i+len(target) <= len(p.src); i++ {
+		if string(p.src[i:i+len(target)]) == str {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *jsLiteralParser) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("position %d: %s", p.pos, fmt.Sprintf(format, v...))
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(c)
+}
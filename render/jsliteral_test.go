@@ -0,0 +1,65 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		data     string
+		repaired bool
+		coerced  string
+	}{
+		{"strict JSON", ` {"a": [1, 2]} `, `{"a": [1, 2]}`, false, ""},
+		{"assignment", `var toc = {"a": 1};`, `{"a": 1}`, true, ""},
+		{"let assignment", `let toc={"a":1}`, `{"a":1}`, true, ""},
+		{"property assignment", `window.docsan.toc = [1];`, `[1]`, true, ""},
+		{"subscript assignment", `data["toc"] = {"a": 1}`, `{"a": 1}`, true, ""},
+		{"equals sign in a string", `var x = {"a": "b=c"};`, `{"a": "b=c"}`, true, ""},
+		{"equals sign in a string with subscript", `data['x'] = {'a': 'b=c'}`, `{"a":"b=c"}`, true, ""},
+		{"comparison", `a == {"a": 1}`, `a == {"a": 1}`, false, ""},
+		{"comments", "{\n// line\n\"a\": /* block */ 1}", `{"a":1}`, true, ""},
+		{"trailing commas", `{"a": [1, 2,], "b": 3,}`, `{"a":[1,2],"b":3}`, true, ""},
+		{"single quotes", `{'a': 'it\'s "quoted"'}`, `{"a":"it's \"quoted\""}`, true, ""},
+		{"template string", "{a: `line\nbreak`}", `{"a":"line\nbreak"}`, true, ""},
+		{"unquoted keys", `{title: "T", $id: 1, _n: 2}`, `{"title":"T","$id":1,"_n":2}`, true, ""},
+		{"hex numbers", `{a: 0x1F, b: -0x10, c: +5}`, `{"a":31,"b":-16,"c":5}`, true, ""},
+		{"escapes", `{a: '\x41B\u{1F600}😀'}`, `{"a":"AB😀😀"}`, true, ""},
+		{"undefined", `{a: undefined}`, `{"a":null}`, true, "undefined"},
+		{"NaN and Infinity", `[NaN, Infinity, -Infinity, +Infinity]`, `[null,null,null,null]`, true, "NaN, Infinity, -Infinity, +Infinity"},
+		{"unparsable", `var toc = {a: }`, `var toc = {a: }`, false, ""},
+		{"unterminated", `{'a': 1`, `{'a': 1`, false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, repaired, coerced := normalizeJSON(test.script)
+			if data != test.data || repaired != test.repaired {
+				t.Errorf("normalized to %s (repaired %t), want %s (repaired %t)", data, repaired, test.data, test.repaired)
+			}
+			if strings.Join(coerced, ", ") != test.coerced {
+				t.Errorf("coerced %v, want %s", coerced, test.coerced)
+			}
+		})
+	}
+}
+
+func TestCoercedValuesAreDiagnosed(t *testing.T) {
+	document := transform(t, `<html><body>
+		<script type="application/json" id="sumtab">var sumtab = {rate: NaN, cap: Infinity};</script>
+		</body></html>`)
+	if string(document.Sumtab.data) != `{"rate":null,"cap":null}` {
+		t.Errorf("sumtab is %s", document.Sumtab.data)
+	}
+	for _, d := range document.Diagnostics {
+		if d.Code == CodeCoercedValue {
+			if d.Severity != SeverityWarning || d.Section != "sumtab" || d.Message != "NaN, Infinity replaced by null" {
+				t.Errorf("diagnostic is %+v", d)
+			}
+			return
+		}
+	}
+	t.Errorf("no %s diagnostic in %v", CodeCoercedValue, document.Diagnostics)
+}
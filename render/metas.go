@@ -0,0 +1,72 @@
+package render
+
+import (
+	"golang.org/x/net/html"
+	"ibfd.org/docsan/node"
+)
+
+// metaNameKeys defines the attributes that name a meta, in order of preference.
+var metaNameKeys = []string{"name", "property", "itemprop"}
+
+// Metadata defines the metas of a document keyed by name. The value
+// is a string, or an array of strings if the name is repeated.
+type Metadata map[string]interface{}
+
+func (df *DocumentFactory) toMetas(nodes []*html.Node) []map[string]string {
+	metaNameAccept := metaAccept(df.config.MetaNameAccept(), df.config.DropTechnicalMetas())
+	metas := node.ToMapArrayFiltered(nodes, metaNameAccept)
+	return metas
+}
+
+// toMetadata groups metas by name. Technical metas are keyed
+// by charset or by http-equiv followed by their header name.
+func toMetadata(metas []map[string]string) Metadata {
+	metadata := make(Metadata, len(metas))
+	for _, meta := range metas {
+		key, value := metaName(meta), meta["content"]
+		if key == "" {
+			if charset, present := meta["charset"]; present {
+				key, value = "charset", charset
+			} else if header, present := meta["http-equiv"]; present {
+				key = "http-equiv:" + header
+			} else {
+				continue
+			}
+		}
+		metadata.add(key, value)
+	}
+	return metadata
+}
+
+// add adds a value to the metadata. Repeated names collect their values in an array.
+func (metadata Metadata) add(key, value string) {
+	switch existing := metadata[key].(type) {
+	case nil:
+		metadata[key] = value
+	case string:
+		metadata[key] = []string{existing, value}
+	case []string:
+		metadata[key] = append(existing, value)
+	}
+}
+
+// metaName gets the name of a meta from its name, property or itemprop attribute.
+// Returns an empty string for technical metas such as charset and http-equiv metas.
+func metaName(attrs map[string]string) string {
+	for _, key := range metaNameKeys {
+		if name := attrs[key]; name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func metaAccept(acceptMetaName func(string) bool, dropTechnical bool) node.CheckAttrs {
+	return func(attrs map[string]string) bool {
+		name := metaName(attrs)
+		if name == "" {
+			return !dropTechnical
+		}
+		return acceptMetaName(name)
+	}
+}
@@ -0,0 +1,142 @@
+package render
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"ibfd.org/docsan/config"
+)
+
+// isoDate defines the ISO-8601 layout of dates without a time of day.
+const isoDate = "2006-01-02"
+
+// normalizeMetadata normalizes the values of the metas that have a configured
+// type. Values that cannot be normalized are left out and reported.
+func (df *DocumentFactory) normalizeMetadata(metadata Metadata) (map[string]interface{}, []*Diagnostic) {
+	types := df.config.MetaTypes()
+	normalized := make(map[string]interface{})
+	var diagnostics []*Diagnostic
+	for _, name := range sortedMetaNames(metadata) {
+		metaType, present := types[name]
+		if !present {
+			continue
+		}
+		var values []interface{}
+		for _, raw := range metaValues(metadata[name]) {
+			value, err := normalizeMetaValue(metaType, strings.TrimSpace(raw))
+			if err != nil {
+				diagnostics = append(diagnostics, &Diagnostic{SeverityWarning, CodeInvalidMeta, "metadata",
+					fmt.Sprintf("%s: %v", name, err)})
+				continue
+			}
+			values = append(values, value)
+		}
+		switch len(values) {
+		case 0:
+		case 1:
+			normalized[name] = values[0]
+		default:
+			normalized[name] = values
+		}
+	}
+	return normalized, diagnostics
+}
+
+func normalizeMetaValue(metaType *config.MetaType, value string) (interface{}, error) {
+	switch metaType.Type {
+	case config.MetaTypeDate:
+		return normalizeDate(value, metaType.Formats)
+	case config.MetaTypeURL:
+		return normalizeURL(value, metaType.Base)
+	case config.MetaTypeEnum:
+		return normalizeEnum(value, metaType.Values)
+	case config.MetaTypeList:
+		return normalizeList(value, metaType.Separator), nil
+	}
+	return value, nil
+}
+
+// normalizeDate parses a date with the first matching layout and formats it as
+// an ISO-8601 date, or as an ISO-8601 date and time if it has a time of day.
+func normalizeDate(value string, formats []string) (string, error) {
+	for _, format := range formats {
+		t, err := time.Parse(format, value)
+		if err != nil {
+			continue
+		}
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+			return t.Format(isoDate), nil
+		}
+		return t.Format(time.RFC3339), nil
+	}
+	return "", fmt.Errorf("date %q does not match any of the formats %s", value, strings.Join(formats, ", "))
+}
+
+// normalizeURL resolves a URL against a base URL.
+func normalizeURL(value string, base string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || value == "" {
+		return "", fmt.Errorf("invalid URL %q", value)
+	}
+	if !u.IsAbs() {
+		if base == "" {
+			return "", fmt.Errorf("relative URL %q without base URL", value)
+		}
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("invalid base URL %q", base)
+		}
+		u = baseURL.ResolveReference(u)
+	}
+	return u.String(), nil
+}
+
+// normalizeEnum lower cases a code and checks it against the allowed values, if any.
+func normalizeEnum(value string, values []string) (string, error) {
+	if len(values) == 0 {
+		if value == "" {
+			return "", fmt.Errorf("empty value")
+		}
+		return strings.ToLower(value), nil
+	}
+	for _, allowed := range values {
+		if strings.EqualFold(allowed, value) {
+			return allowed, nil
+		}
+	}
+	return "", fmt.Errorf("value %q is not one of %s", value, strings.Join(values, ", "))
+}
+
+// normalizeList splits a list and drops empty items.
+func normalizeList(value string, separator string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, separator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// metaValues gets the values of a metadata entry as a list.
+func metaValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	}
+	return nil
+}
+
+func sortedMetaNames(metadata Metadata) []string {
+	names := make([]string, 0, len(metadata))
+	for name := range metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
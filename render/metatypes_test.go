@@ -0,0 +1,26 @@
+package render
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		value string
+		base  string
+		url   string
+		valid bool
+	}{
+		{"https://www.ibfd.org/a", "", "https://www.ibfd.org/a", true},
+		{"docs/a.pdf", "https://research.ibfd.org/collections/", "https://research.ibfd.org/collections/docs/a.pdf", true},
+		{"/a.pdf", "https://research.ibfd.org/collections/", "https://research.ibfd.org/a.pdf", true},
+		{"a.pdf", "", "", false},
+		{"a.pdf", "http://[::1", "", false},
+		{"", "https://research.ibfd.org/", "", false},
+		{"%zz", "https://research.ibfd.org/", "", false},
+	}
+	for _, test := range tests {
+		u, err := normalizeURL(test.value, test.base)
+		if u != test.url || (err == nil) != test.valid {
+			t.Errorf("%q against %q normalized to %q (%v), want %q", test.value, test.base, u, err, test.url)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	log "ibfd.org/docsan/log4u"
+	"ibfd.org/docsan/node"
+)
+
+// These constants define where the outline of a document came from.
+const (
+	OutlineEmbedded  = "embedded"
+	OutlineGenerated = "generated"
+	OutlineNone      = "none"
+)
+
+// generatedIDPrefix prefixes the ids docsan generates for outline targets.
+const generatedIDPrefix = "docsan-outline-"
+
+// maxEntryTitleLength limits the length of titles taken from paragraph text.
+const maxEntryTitleLength = 80
+
+// outlineBuilder builds an outline from the headings and
+// annotatable elements of a document body.
+type outlineBuilder struct {
+	isAnnotatable node.Check
+	isHeading     node.Check
+	root          Outline
+	stack         []*OutlineEntry
+	usedIDs       map[string]bool
+	existingIDs   map[string]bool
+	generated     int
+}
+
+// toOutline gets the outline embedded in the document. If the document
+// has no outline script then an outline is generated from its structure.
+// Returns the outline and its source.
+func (df *DocumentFactory) toOutline(htmlDoc *html.Node, docID string, logger *log.Logger) (*JSON, string) {
+	script := node.FindFirst(htmlDoc, df.outlineSelector)
+	if script != nil {
+		return formatJSON(script, docID, jsonObject, logger), OutlineEmbedded
+	}
+	body := node.FindFirst(htmlDoc, node.Element("body"))
+	if body == nil {
+		return formatJSON(nil, docID, jsonObject, logger), OutlineNone
+	}
+	builder := &outlineBuilder{
+		isAnnotatable: df.placeholderTargetSelector,
+		isHeading:     headingSelector(),
+		usedIDs:       make(map[string]bool),
+		existingIDs:   toAnchors(htmlDoc)}
+	builder.walk(body)
+	if len(builder.root.Items) == 0 {
+		return formatJSON(nil, docID, jsonObject, logger), OutlineNone
+	}
+	data, err := json.Marshal(builder.root)
+	if err != nil {
+		return formatJSON(nil, docID, jsonObject, logger), OutlineNone
+	}
+	return newJSON(docID, jsonObject, string(data)), OutlineGenerated
+}
+
+func (b *outlineBuilder) walk(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case b.isHeading(c):
+			b.addHeading(c)
+		case b.isAnnotatable(c) && node.FindFirst(c, b.isHeading) == nil:
+			b.addAnnotatable(c)
+		default:
+			b.walk(c)
+		}
+	}
+}
+
+// addHeading adds an entry for a heading. The heading is identified by
+// its own id, the id of the annotatable element around it or a generated id.
+func (b *outlineBuilder) addHeading(heading *html.Node) {
+	title := node.Text(heading)
+	if title == "" {
+		return
+	}
+	id := node.AttrsAsMap(heading)["id"]
+	if id == "" {
+		if annotatable := node.FindAncestor(heading, b.isAnnotatable); annotatable != nil {
+			if ancestorID := node.AttrsAsMap(annotatable)["id"]; !b.usedIDs[ancestorID] {
+				id = ancestorID
+			}
+		}
+	}
+	if id == "" {
+		id = b.generateID(heading)
+	}
+	b.add(&OutlineEntry{ID: id, Title: title, Level: int(heading.Data[1] - '0')})
+}
+
+// addAnnotatable adds an entry for an annotatable element without heading.
+// It is placed one level below the current heading.
+func (b *outlineBuilder) addAnnotatable(n *html.Node) {
+	title := truncate(node.Text(n), maxEntryTitleLength)
+	if title == "" {
+		return
+	}
+	level := 1
+	if len(b.stack) > 0 {
+		level = b.stack[len(b.stack)-1].Level + 1
+	}
+	b.add(&OutlineEntry{ID: node.AttrsAsMap(n)["id"], Title: title, Level: level})
+}
+
+// add adds an entry to the outline below the closest entry with a lower level.
+func (b *outlineBuilder) add(entry *OutlineEntry) {
+	b.usedIDs[entry.ID] = true
+	for len(b.stack) > 0 && b.stack[len(b.stack)-1].Level >= entry.Level {
+		b.stack = b.stack[:len(b.stack)-1]
+	}
+	if len(b.stack) == 0 {
+		b.root.Items = append(b.root.Items, entry)
+	} else {
+		parent := b.stack[len(b.stack)-1]
+		parent.Items = append(parent.Items, entry)
+	}
+	b.stack = append(b.stack, entry)
+}
+
+// generateID generates an id from the position of the heading in the
+// document and sets it on the heading so the outline entry can refer to it.
+// Ids that are already taken in the document are skipped.
+func (b *outlineBuilder) generateID(heading *html.Node) string {
+	var id string
+	for id == "" || b.existingIDs[id] || b.usedIDs[id] {
+		b.generated++
+		id = fmt.Sprintf("%s%d", generatedIDPrefix, b.generated)
+	}
+	setAttr(heading, "id", id)
+	return id
+}
+
+// setAttr sets an attribute of an element, replacing its current value.
+func setAttr(n *html.Node, key string, value string) {
+	for i := range n.Attr {
+		if n.Attr[i].Namespace == "" && n.Attr[i].Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
+
+func headingSelector() node.Check {
+	return node.Or(node.Element("h1"), node.Element("h2"), node.Element("h3"),
+		node.Element("h4"), node.Element("h5"), node.Element("h6"))
+}
+
+// truncate shortens a text to at most max runes at a word boundary.
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	cut := string(runes[:max])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "..."
+}
@@ -0,0 +1,59 @@
+package render
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedOutlineIDs(t *testing.T) {
+	document := transform(t, `<html><body>
+		<h1 id="intro">Introduction</h1>
+		<h2>Missing id</h2>
+		<h2 id="">Empty id</h2>
+		<p id="docsan-outline-2">Takes a generated id</p>
+		<h2>Colliding id</h2>
+		<div class="annotatable" id="p5"><h3>From annotatable</h3></div>
+		</body></html>`)
+	if document.OutlineSource != OutlineGenerated {
+		t.Fatalf("outline source is %s, want %s", document.OutlineSource, OutlineGenerated)
+	}
+	var outline Outline
+	if err := json.Unmarshal(document.Outline.data, &outline); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	var collect func(entries []*OutlineEntry)
+	collect = func(entries []*OutlineEntry) {
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+			collect(entry.Items)
+		}
+	}
+	collect(outline.Items)
+	want := []string{"intro", "docsan-outline-1", "docsan-outline-3", "docsan-outline-4", "p5"}
+	if strings.Join(ids, " ") != strings.Join(want, " ") {
+		t.Errorf("outline ids are %v, want %v", ids, want)
+	}
+	for _, fragment := range []string{`<h2 id="docsan-outline-1">`, `<h2 id="docsan-outline-3">`, `<h2 id="docsan-outline-4">`, `<h3>`} {
+		if !strings.Contains(document.Body, fragment) {
+			t.Errorf("body does not contain %s", fragment)
+		}
+	}
+	if strings.Contains(document.Body, `id=""`) {
+		t.Error("body keeps an empty id")
+	}
+}
+
+func TestEmbeddedOutlineIsKept(t *testing.T) {
+	document := transform(t, `<html><body>
+		<script type="application/json" id="outline">{"items": [{"id": "a", "title": "A"}]}</script>
+		<h1>Heading</h1>
+		</body></html>`)
+	if document.OutlineSource != OutlineEmbedded {
+		t.Errorf("outline source is %s, want %s", document.OutlineSource, OutlineEmbedded)
+	}
+	if strings.Contains(document.Body, "docsan-outline-") {
+		t.Error("ids generated for an embedded outline")
+	}
+}
@@ -0,0 +1,19 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// indent defines the indentation of pretty printed JSON.
+const indent = "  "
+
+// ToJSON writes a document as JSON. Nothing is written if the document
+// cannot be encoded.
+func (document *Document) ToJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if document.config.JSONPretty() {
+		enc.SetIndent("", indent)
+	}
+	return enc.Encode(document)
+}
@@ -0,0 +1,25 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestToJSONMatchesMarshal(t *testing.T) {
+	document := transform(t, `<html><head><title>T</title></head><body>
+		<script type="application/json" id="tables">[{"id": "t1"}]</script>
+		<p id="p1"><a href="#p1">self</a></p>
+		</body></html>`)
+	var out bytes.Buffer
+	if err := document.ToJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != string(want)+"\n" {
+		t.Errorf("ToJSON wrote %s, want %s", out.String(), want)
+	}
+}
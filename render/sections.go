@@ -0,0 +1,261 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Section defines a typed data section that can normalize itself.
+type Section interface {
+	Normalize()
+}
+
+// Outline defines the outline of a document.
+type Outline struct {
+	Items []*OutlineEntry `json:"items"`
+}
+
+// OutlineEntry defines an entry in an outline. The id refers to
+// the anchor of the entry in the document body.
+type OutlineEntry struct {
+	ID    string          `json:"id"`
+	Title string          `json:"title"`
+	Level int             `json:"level,omitempty"`
+	Items []*OutlineEntry `json:"items,omitempty"`
+}
+
+// Sumtab defines the summary table of a document.
+type Sumtab struct {
+	Title string        `json:"title,omitempty"`
+	Items []*SumtabItem `json:"items"`
+}
+
+// SumtabItem defines a row in a summary table.
+type SumtabItem struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+	Href  string `json:"href,omitempty"`
+}
+
+// LinkTarget defines a link from a paragraph to another location.
+type LinkTarget struct {
+	Href  string `json:"href"`
+	Title string `json:"title,omitempty"`
+	DocID string `json:"docid,omitempty"`
+}
+
+// Links defines the links of a document keyed by paragraph id.
+type Links map[string][]*LinkTarget
+
+// SeeAlso defines the see also references of a document keyed by paragraph id.
+type SeeAlso map[string][]*LinkTarget
+
+// Tables defines the tables of a document.
+type Tables []*TableEntry
+
+// TableEntry defines a table in a document.
+type TableEntry struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Lookup defines the lookup entries of a document.
+type Lookup []*LookupEntry
+
+// LookupEntry defines a key to look up and the value it resolves to.
+type LookupEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Sections defines the typed data sections of a document.
+type Sections struct {
+	Outline *Outline
+	Sumtab  *Sumtab
+	Links   Links
+	SeeAlso SeeAlso
+	Tables  Tables
+	Lookup  Lookup
+}
+
+// Typed decodes the data sections of a document into Go structs.
+// Returns an error if a section does not match its Go model.
+func (document *Document) Typed() (*Sections, error) {
+	sections := &Sections{}
+	for _, s := range document.typedSections(sections) {
+		if err := s.json.decode(s.model); err != nil {
+			return nil, err
+		}
+	}
+	return sections, nil
+}
+
+// typedSection links a data section to its Go model.
+type typedSection struct {
+	name  string
+	json  *JSON
+	model Section
+}
+
+func (document *Document) typedSections(sections *Sections) []typedSection {
+	sections.Outline = &Outline{}
+	sections.Sumtab = &Sumtab{}
+	return []typedSection{
+		{"outline", document.Outline, sections.Outline},
+		{"sumtab", document.Sumtab, sections.Sumtab},
+		{"links", document.DocLinks, &sections.Links},
+		{"seealso", document.SeeAlso, &sections.SeeAlso},
+		{"tables", document.Tables, &sections.Tables},
+		{"lookup", document.Lookup, &sections.Lookup},
+	}
+}
+
+// normalizeSections decodes the data sections into their Go models,
+// normalizes them and encodes them again. Sections that do not
+// match their model are left as they are.
+func (document *Document) normalizeSections() {
+	for _, s := range document.typedSections(&Sections{}) {
+		if s.json.isEmpty() {
+			continue
+		}
+		if err := s.json.decode(s.model); err != nil {
+			s.json.untyped = err
+			continue
+		}
+		s.model.Normalize()
+		data, err := json.Marshal(s.model)
+		if err != nil {
+			s.json.untyped = err
+			continue
+		}
+		s.json.data = data
+	}
+}
+
+// decode decodes pre-rendered JSON into a Go model.
+// Unknown fields are not accepted, so no data gets lost.
+func (j *JSON) decode(model Section) error {
+	if j.invalid {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(j.data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(model)
+}
+
+// isEmpty checks whether pre-rendered JSON is the empty value of its type.
+func (j *JSON) isEmpty() bool {
+	return string(j.data) == j.jtype.emptyJSON()
+}
+
+// Normalize trims the outline entries and removes entries with duplicate ids.
+func (outline *Outline) Normalize() {
+	outline.Items = normalizeOutlineEntries(outline.Items, make(map[string]bool))
+}
+
+func normalizeOutlineEntries(entries []*OutlineEntry, seen map[string]bool) []*OutlineEntry {
+	result := make([]*OutlineEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		entry.ID = strings.TrimSpace(entry.ID)
+		entry.Title = strings.Join(strings.Fields(entry.Title), " ")
+		if entry.ID != "" && seen[entry.ID] {
+			continue
+		}
+		seen[entry.ID] = true
+		entry.Items = normalizeOutlineEntries(entry.Items, seen)
+		result = append(result, entry)
+	}
+	return result
+}
+
+// Normalize trims the summary table and removes duplicate rows.
+func (sumtab *Sumtab) Normalize() {
+	sumtab.Title = strings.TrimSpace(sumtab.Title)
+	seen := make(map[SumtabItem]bool)
+	items := make([]*SumtabItem, 0, len(sumtab.Items))
+	for _, item := range sumtab.Items {
+		if item == nil {
+			continue
+		}
+		item.Label = strings.TrimSpace(item.Label)
+		item.Value = strings.TrimSpace(item.Value)
+		item.Href = strings.TrimSpace(item.Href)
+		if !seen[*item] {
+			seen[*item] = true
+			items = append(items, item)
+		}
+	}
+	sumtab.Items = items
+}
+
+// Normalize trims the links and removes duplicate links per paragraph.
+func (links *Links) Normalize() {
+	normalizeLinkTargets(*links)
+}
+
+// Normalize trims the references and removes duplicate references per paragraph.
+func (seeAlso *SeeAlso) Normalize() {
+	normalizeLinkTargets(*seeAlso)
+}
+
+func normalizeLinkTargets(targets map[string][]*LinkTarget) {
+	for id, list := range targets {
+		seen := make(map[string]bool)
+		result := make([]*LinkTarget, 0, len(list))
+		for _, target := range list {
+			if target == nil {
+				continue
+			}
+			target.Href = strings.TrimSpace(target.Href)
+			target.Title = strings.TrimSpace(target.Title)
+			target.DocID = strings.TrimSpace(target.DocID)
+			if !seen[target.Href] {
+				seen[target.Href] = true
+				result = append(result, target)
+			}
+		}
+		targets[id] = result
+	}
+}
+
+// Normalize trims the table entries and removes entries with duplicate ids.
+func (tables *Tables) Normalize() {
+	seen := make(map[string]bool)
+	result := make(Tables, 0, len(*tables))
+	for _, table := range *tables {
+		if table == nil {
+			continue
+		}
+		table.ID = strings.TrimSpace(table.ID)
+		table.Title = strings.TrimSpace(table.Title)
+		if table.ID != "" && seen[table.ID] {
+			continue
+		}
+		seen[table.ID] = true
+		result = append(result, table)
+	}
+	*tables = result
+}
+
+// Normalize trims the lookup entries and removes entries with duplicate keys.
+func (lookup *Lookup) Normalize() {
+	seen := make(map[string]bool)
+	result := make(Lookup, 0, len(*lookup))
+	for _, entry := range *lookup {
+		if entry == nil {
+			continue
+		}
+		entry.Key = strings.TrimSpace(entry.Key)
+		entry.Value = strings.TrimSpace(entry.Value)
+		if entry.Key != "" && seen[entry.Key] {
+			continue
+		}
+		seen[entry.Key] = true
+		result = append(result, entry)
+	}
+	*lookup = result
+}
@@ -0,0 +1,24 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTablesNormalizeKeepsEntriesWithoutID(t *testing.T) {
+	tables := Tables{{ID: " t1 ", Title: "A"}, {Title: "B"}, {ID: "t1", Title: "C"}, nil, {ID: " ", Title: "D"}}
+	tables.Normalize()
+	want := Tables{{ID: "t1", Title: "A"}, {Title: "B"}, {Title: "D"}}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables normalized to %v, want %v", tables, want)
+	}
+}
+
+func TestLookupNormalizeKeepsEntriesWithoutKey(t *testing.T) {
+	lookup := Lookup{{Key: "k", Value: "1"}, {Value: "2"}, {Key: " k", Value: "3"}, {Key: "", Value: "4"}}
+	lookup.Normalize()
+	want := Lookup{{Key: "k", Value: "1"}, {Value: "2"}, {Value: "4"}}
+	if !reflect.DeepEqual(lookup, want) {
+		t.Errorf("lookup normalized to %v, want %v", lookup, want)
+	}
+}
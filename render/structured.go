@@ -0,0 +1,144 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"ibfd.org/docsan/node"
+)
+
+// dublinCorePrefixes defines the meta name prefixes of Dublin Core metas.
+var dublinCorePrefixes = []string{"dc.", "dcterms."}
+
+// microdataURLAttrs defines the attribute holding the value of
+// microdata properties on elements that refer to a resource.
+var microdataURLAttrs = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"link":   "href",
+	"audio":  "src",
+	"embed":  "src",
+	"iframe": "src",
+	"img":    "src",
+	"source": "src",
+	"track":  "src",
+	"video":  "src",
+	"object": "data",
+	"meta":   "content",
+	"time":   "datetime",
+	"data":   "value",
+	"meter":  "value",
+}
+
+// Structured defines the structured data of a document.
+type Structured struct {
+	JSONLD     []json.RawMessage `json:"jsonld"`
+	Microdata  []*MicrodataItem  `json:"microdata"`
+	DublinCore Metadata          `json:"dublincore"`
+}
+
+// MicrodataItem defines a microdata item. Property values are strings or nested items.
+type MicrodataItem struct {
+	Type       []string                 `json:"type,omitempty"`
+	ID         string                   `json:"id,omitempty"`
+	Properties map[string][]interface{} `json:"properties"`
+}
+
+// toStructured extracts JSON-LD blocks, microdata items and Dublin Core metas.
+func (df *DocumentFactory) toStructured(htmlDoc *html.Node, head *html.Node) (*Structured, []*Diagnostic) {
+	structured := &Structured{
+		JSONLD:     make([]json.RawMessage, 0),
+		Microdata:  make([]*MicrodataItem, 0),
+		DublinCore: toDublinCore(head)}
+	var diagnostics []*Diagnostic
+	for i, script := range node.FindAll(htmlDoc, df.jsonLDSelector) {
+		var data string
+		if script.FirstChild != nil {
+			data = strings.TrimSpace(script.FirstChild.Data)
+		}
+		if !json.Valid([]byte(data)) {
+			diagnostics = append(diagnostics, &Diagnostic{SeverityError, CodeInvalidJSON, "structured",
+				fmt.Sprintf("invalid JSON-LD block %d ignored", i+1)})
+			continue
+		}
+		structured.JSONLD = append(structured.JSONLD, json.RawMessage(data))
+	}
+	for _, n := range node.FindAll(htmlDoc, df.microdataSelector) {
+		structured.Microdata = append(structured.Microdata, toMicrodataItem(n))
+	}
+	return structured, diagnostics
+}
+
+// toDublinCore collects the Dublin Core metas keyed by term.
+func toDublinCore(head *html.Node) Metadata {
+	dublinCore := make(Metadata)
+	for _, meta := range node.FindAll(head, node.Element("meta")) {
+		attrs := node.AttrsAsMap(meta)
+		name := strings.ToLower(attrs["name"])
+		for _, prefix := range dublinCorePrefixes {
+			if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+				dublinCore.add(name[len(prefix):], attrs["content"])
+				break
+			}
+		}
+	}
+	return dublinCore
+}
+
+// toMicrodataItem creates a microdata item from an element with an itemscope attribute.
+func toMicrodataItem(n *html.Node) *MicrodataItem {
+	attrs := node.AttrsAsMap(n)
+	item := &MicrodataItem{
+		Type:       strings.Fields(attrs["itemtype"]),
+		ID:         attrs["itemid"],
+		Properties: make(map[string][]interface{})}
+	collectMicrodataProperties(item, n)
+	return item
+}
+
+// collectMicrodataProperties adds the properties below an element to an item.
+// The properties of nested items are not included.
+func collectMicrodataProperties(item *MicrodataItem, n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		attrs := node.AttrsAsMap(c)
+		_, isItem := attrs["itemscope"]
+		if names := strings.Fields(attrs["itemprop"]); len(names) > 0 {
+			var value interface{}
+			if isItem {
+				value = toMicrodataItem(c)
+			} else {
+				value = microdataValue(c, attrs)
+			}
+			for _, name := range names {
+				item.Properties[name] = append(item.Properties[name], value)
+			}
+		}
+		if !isItem {
+			collectMicrodataProperties(item, c)
+		}
+	}
+}
+
+// microdataValue gets the value of a microdata property element.
+func microdataValue(n *html.Node, attrs map[string]string) string {
+	if attr, present := microdataURLAttrs[n.Data]; present {
+		if value, present := attrs[attr]; present {
+			return value
+		}
+	}
+	return node.Text(n)
+}
+
+func jsonLDSelector() node.Check {
+	return node.And(node.Element("script"), node.AttrEquals("type", "application/ld+json"))
+}
+
+// microdataSelector selects the top level microdata items.
+func microdataSelector() node.Check {
+	return node.And(node.AnyElement(), node.HasAttr("itemscope"), node.Not(node.HasAttr("itemprop")))
+}
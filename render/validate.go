@@ -0,0 +1,45 @@
+package render
+
+import (
+	"encoding/json"
+
+	"ibfd.org/docsan/codes"
+	"ibfd.org/docsan/config"
+)
+
+// Violation defines a schema violation in a section of a document.
+type Violation struct {
+	Section string `json:"section"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// validateSections validates the sections of a document against the
+// configured schemas. Sections that violate their schema are replaced
+// by an empty value if the schema policy says so.
+func (document *Document) validateSections() []*Violation {
+	schemas := document.config.Schemas()
+	var violations []*Violation
+	for _, s := range document.sections() {
+		sectionSchema, present := schemas[s.name]
+		if !present {
+			continue
+		}
+		var data interface{}
+		if err := json.Unmarshal(s.json.data, &data); err != nil {
+			continue
+		}
+		found := sectionSchema.Validate(data)
+		if len(found) == 0 {
+			continue
+		}
+		document.log.Log(codes.SchemaViolation, s.name, len(found))
+		for _, v := range found {
+			violations = append(violations, &Violation{s.name, v.Path, v.Message})
+		}
+		if document.config.SchemaPolicy() == config.SchemaPolicyReplace {
+			s.json.data = json.RawMessage(s.json.jtype.emptyJSON())
+		}
+	}
+	return violations
+}
@@ -0,0 +1,463 @@
+// Package schema implements validation of JSON data against a JSON Schema.
+// It supports the subset of JSON Schema (draft 7) that is needed to describe
+// the data sections of documents: type, enum, const, properties, required,
+// additionalProperties, items, the size and range keywords, pattern,
+// allOf, anyOf, oneOf, not and local references ($ref) to any subschema
+// of the same document.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema defines a compiled JSON Schema.
+type Schema struct {
+	root  *node
+	nodes map[string]*node // the subschemas by JSON pointer
+}
+
+// Violation defines a location in the data that does not match the schema.
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// node defines a schema or subschema.
+type node struct {
+	always               *bool
+	ref                  string
+	types                []string
+	enum                 []interface{}
+	constant             interface{}
+	hasConst             bool
+	properties           map[string]*node
+	required             []string
+	additionalProperties *node
+	items                *node
+	tupleItems           []*node
+	minItems             *int
+	maxItems             *int
+	minLength            *int
+	maxLength            *int
+	minimum              *float64
+	maximum              *float64
+	pattern              *regexp.Regexp
+	allOf                []*node
+	anyOf                []*node
+	oneOf                []*node
+	not                  *node
+}
+
+// compiler collects the subschemas of a schema by location, so that
+// references can be resolved against the whole document.
+type compiler struct {
+	nodes map[string]*node
+	refs  map[string]string // reference by location of the referring subschema
+}
+
+// Parse compiles a JSON Schema.
+func Parse(data []byte) (*Schema, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	c := &compiler{nodes: make(map[string]*node), refs: make(map[string]string)}
+	root, err := c.compile(raw, "#")
+	if err != nil {
+		return nil, err
+	}
+	for location, ref := range c.refs {
+		if _, ok := c.nodes[pointer(ref)]; !ok {
+			return nil, fmt.Errorf("%s/$ref: unresolvable reference %s", location, ref)
+		}
+	}
+	return &Schema{root, c.nodes}, nil
+}
+
+// Validate validates data, as decoded by encoding/json into an
+// interface{}, against the schema. Returns the violations found.
+func (s *Schema) Validate(data interface{}) []*Violation {
+	v := &validator{nodes: s.nodes}
+	v.validate(s.root, data, "")
+	return v.violations
+}
+
+// ValidateJSON validates a JSON document against the schema.
+func (s *Schema) ValidateJSON(data []byte) ([]*Violation, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return s.Validate(decoded), nil
+}
+
+func (c *compiler) compile(raw interface{}, location string) (*node, error) {
+	var n *node
+	var err error
+	switch v := raw.(type) {
+	case bool:
+		n = &node{always: &v}
+	case map[string]interface{}:
+		n, err = c.compileObject(v, location)
+	default:
+		err = fmt.Errorf("%s: schema must be an object or a boolean", location)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.nodes[location] = n
+	return n, nil
+}
+
+func (c *compiler) compileObject(m map[string]interface{}, location string) (*node, error) {
+	n := &node{}
+	var err error
+	if ref, ok := m["$ref"].(string); ok {
+		if !strings.HasPrefix(ref, "#") {
+			return nil, fmt.Errorf("%s/$ref: only local references are supported, found %s", location, ref)
+		}
+		n.ref = ref
+		c.refs[location] = ref
+	}
+	switch t := m["type"].(type) {
+	case string:
+		n.types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			if str, ok := item.(string); ok {
+				n.types = append(n.types, str)
+			}
+		}
+	}
+	if enum, ok := m["enum"].([]interface{}); ok {
+		n.enum = enum
+	}
+	if constant, ok := m["const"]; ok {
+		n.constant = constant
+		n.hasConst = true
+	}
+	if props, ok := m["properties"].(map[string]interface{}); ok {
+		n.properties = make(map[string]*node, len(props))
+		for name, prop := range props {
+			if n.properties[name], err = c.compile(prop, location+"/properties/"+escape(name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if required, ok := m["required"].([]interface{}); ok {
+		for _, item := range required {
+			if str, ok := item.(string); ok {
+				n.required = append(n.required, str)
+			}
+		}
+	}
+	if additional, ok := m["additionalProperties"]; ok {
+		if n.additionalProperties, err = c.compile(additional, location+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+	switch items := m["items"].(type) {
+	case []interface{}:
+		if n.tupleItems, err = c.compileList(items, location+"/items"); err != nil {
+			return nil, err
+		}
+	case nil:
+	default:
+		if n.items, err = c.compile(items, location+"/items"); err != nil {
+			return nil, err
+		}
+	}
+	n.minItems = intKeyword(m, "minItems")
+	n.maxItems = intKeyword(m, "maxItems")
+	n.minLength = intKeyword(m, "minLength")
+	n.maxLength = intKeyword(m, "maxLength")
+	n.minimum = numberKeyword(m, "minimum")
+	n.maximum = numberKeyword(m, "maximum")
+	if pattern, ok := m["pattern"].(string); ok {
+		if n.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %v", location, err)
+		}
+	}
+	for keyword, target := range map[string]*[]*node{"allOf": &n.allOf, "anyOf": &n.anyOf, "oneOf": &n.oneOf} {
+		if list, ok := m[keyword].([]interface{}); ok {
+			if *target, err = c.compileList(list, location+"/"+keyword); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if not, ok := m["not"]; ok {
+		if n.not, err = c.compile(not, location+"/not"); err != nil {
+			return nil, err
+		}
+	}
+	// Definitions are only compiled to be referenced.
+	for _, keyword := range []string{"definitions", "$defs"} {
+		if defs, ok := m[keyword].(map[string]interface{}); ok {
+			for name, def := range defs {
+				if _, err = c.compile(def, location+"/"+keyword+"/"+escape(name)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return n, nil
+}
+
+func (c *compiler) compileList(list []interface{}, location string) ([]*node, error) {
+	nodes := make([]*node, 0, len(list))
+	for i, item := range list {
+		n, err := c.compile(item, location+"/"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func intKeyword(m map[string]interface{}, keyword string) *int {
+	if f, ok := m[keyword].(float64); ok {
+		i := int(f)
+		return &i
+	}
+	return nil
+}
+
+func numberKeyword(m map[string]interface{}, keyword string) *float64 {
+	if f, ok := m[keyword].(float64); ok {
+		return &f
+	}
+	return nil
+}
+
+// validator collects the violations found while validating data.
+type validator struct {
+	nodes      map[string]*node
+	violations []*Violation
+	depth      int
+}
+
+// maxRefDepth limits the nesting of references to detect reference loops.
+const maxRefDepth = 64
+
+func (v *validator) report(path string, format string, args ...interface{}) {
+	if path == "" {
+		path = "/"
+	}
+	v.violations = append(v.violations, &Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate(n *node, data interface{}, path string) {
+	if n.always != nil {
+		if !*n.always {
+			v.report(path, "no value allowed")
+		}
+		return
+	}
+	if n.ref != "" {
+		v.validateRef(n.ref, data, path)
+	}
+	if len(n.types) > 0 && !matchesAnyType(n.types, data) {
+		v.report(path, "expected %s but found %s", strings.Join(n.types, " or "), typeOf(data))
+		return
+	}
+	if n.enum != nil && !containsValue(n.enum, data) {
+		v.report(path, "value is not one of the allowed values")
+	}
+	if n.hasConst && !equal(n.constant, data) {
+		v.report(path, "value does not match the constant")
+	}
+	switch d := data.(type) {
+	case map[string]interface{}:
+		v.validateObject(n, d, path)
+	case []interface{}:
+		v.validateArray(n, d, path)
+	case string:
+		v.validateString(n, d, path)
+	case float64:
+		v.validateNumber(n, d, path)
+	}
+	v.validateCombinations(n, data, path)
+}
+
+func (v *validator) validateRef(ref string, data interface{}, path string) {
+	target, ok := v.nodes[pointer(ref)]
+	if !ok {
+		v.report(path, "unresolvable reference %s", ref)
+		return
+	}
+	if v.depth >= maxRefDepth {
+		v.report(path, "reference %s nested too deeply", ref)
+		return
+	}
+	v.depth++
+	v.validate(target, data, path)
+	v.depth--
+}
+
+func (v *validator) validateObject(n *node, m map[string]interface{}, path string) {
+	for _, name := range n.required {
+		if _, present := m[name]; !present {
+			v.report(path, "missing required property %s", name)
+		}
+	}
+	for _, name := range sortedKeys(m) {
+		value := m[name]
+		propPath := path + "/" + escape(name)
+		if prop, ok := n.properties[name]; ok {
+			v.validate(prop, value, propPath)
+		} else if n.additionalProperties != nil {
+			if n.additionalProperties.always != nil && !*n.additionalProperties.always {
+				v.report(propPath, "property %s is not allowed", name)
+			} else {
+				v.validate(n.additionalProperties, value, propPath)
+			}
+		}
+	}
+}
+
+func (v *validator) validateArray(n *node, list []interface{}, path string) {
+	if n.minItems != nil && len(list) < *n.minItems {
+		v.report(path, "expected at least %d items but found %d", *n.minItems, len(list))
+	}
+	if n.maxItems != nil && len(list) > *n.maxItems {
+		v.report(path, "expected at most %d items but found %d", *n.maxItems, len(list))
+	}
+	for i, item := range list {
+		itemPath := path + "/" + strconv.Itoa(i)
+		if i < len(n.tupleItems) {
+			v.validate(n.tupleItems[i], item, itemPath)
+		} else if n.items != nil {
+			v.validate(n.items, item, itemPath)
+		}
+	}
+}
+
+func (v *validator) validateString(n *node, str string, path string) {
+	length := utf8.RuneCountInString(str)
+	if n.minLength != nil && length < *n.minLength {
+		v.report(path, "expected at least %d characters but found %d", *n.minLength, length)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		v.report(path, "expected at most %d characters but found %d", *n.maxLength, length)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(str) {
+		v.report(path, "value does not match pattern %s", n.pattern)
+	}
+}
+
+func (v *validator) validateNumber(n *node, f float64, path string) {
+	if n.minimum != nil && f < *n.minimum {
+		v.report(path, "value %v is less than minimum %v", f, *n.minimum)
+	}
+	if n.maximum != nil && f > *n.maximum {
+		v.report(path, "value %v is greater than maximum %v", f, *n.maximum)
+	}
+}
+
+func (v *validator) validateCombinations(n *node, data interface{}, path string) {
+	for _, sub := range n.allOf {
+		v.validate(sub, data, path)
+	}
+	if len(n.anyOf) > 0 && v.countMatches(n.anyOf, data, path) == 0 {
+		v.report(path, "value does not match any of the allowed schemas")
+	}
+	if len(n.oneOf) > 0 {
+		if matches := v.countMatches(n.oneOf, data, path); matches != 1 {
+			v.report(path, "value matches %d schemas instead of exactly one", matches)
+		}
+	}
+	if n.not != nil && v.countMatches([]*node{n.not}, data, path) == 1 {
+		v.report(path, "value matches a schema it must not match")
+	}
+}
+
+// countMatches counts the subschemas the data is valid against.
+func (v *validator) countMatches(nodes []*node, data interface{}, path string) int {
+	matches := 0
+	for _, sub := range nodes {
+		trial := &validator{nodes: v.nodes, depth: v.depth}
+		trial.validate(sub, data, path)
+		if len(trial.violations) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func matchesAnyType(types []string, data interface{}) bool {
+	actual := typeOf(data)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(data interface{}) string {
+	switch d := data.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if d == math.Trunc(d) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", data)
+	}
+}
+
+func containsValue(values []interface{}, data interface{}) bool {
+	for _, value := range values {
+		if equal(value, data) {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escape escapes a property name for use in a JSON pointer.
+func escape(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
+
+// pointer returns the location of the subschema a local reference refers
+// to, which is its URL decoded fragment.
+func pointer(ref string) string {
+	if unescaped, err := url.PathUnescape(ref); err == nil {
+		return unescaped
+	}
+	return ref
+}
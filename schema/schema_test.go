@@ -0,0 +1,104 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+const outlineSchema = `{
+	"type": "object",
+	"required": ["items"],
+	"properties": {
+		"kind": {"enum": ["chapter", "section"]},
+		"items": {"type": "array", "items": {"$ref": "#/definitions/item"}},
+		"first": {"$ref": "#/properties/items/items"}
+	},
+	"definitions": {
+		"item": {
+			"type": "object",
+			"required": ["id", "title"],
+			"properties": {
+				"id": {"type": "string", "minLength": 1},
+				"title": {"type": "string"},
+				"level": {"type": "integer", "minimum": 1},
+				"items": {"type": "array", "items": {"$ref": "#/definitions/item"}}
+			},
+			"additionalProperties": false
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(outlineSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		data       string
+		violations []string
+	}{
+		{"valid", `{"kind": "chapter", "items": [{"id": "a", "title": "A", "items": [{"id": "b", "title": "B", "level": 2}]}]}`, nil},
+		{"type", `[]`, []string{"/: expected object but found array"}},
+		{"required", `{"kind": "section"}`, []string{"/: missing required property items"}},
+		{"enum", `{"kind": "part", "items": []}`, []string{"/kind: value is not one of the allowed values"}},
+		{"items", `{"items": [{"id": "", "title": 1}]}`, []string{
+			"/items/0/id: expected at least 1 characters but found 0",
+			"/items/0/title: expected string but found integer"}},
+		{"nested reference", `{"items": [{"id": "a", "title": "A", "items": [{"id": "b"}]}]}`, []string{
+			"/items/0/items/0: missing required property title"}},
+		{"additional properties", `{"items": [{"id": "a", "title": "A", "page": 3}]}`, []string{
+			"/items/0/page: property page is not allowed"}},
+		{"integer", `{"items": [{"id": "a", "title": "A", "level": 1.5}]}`, []string{
+			"/items/0/level: expected integer but found number"}},
+		{"reference to a property", `{"items": [], "first": {"id": "a"}}`, []string{
+			"/first: missing required property title"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found, err := s.ValidateJSON([]byte(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var violations []string
+			for _, v := range found {
+				violations = append(violations, v.Path+": "+v.Message)
+			}
+			if strings.Join(violations, "\n") != strings.Join(test.violations, "\n") {
+				t.Errorf("violations are %q, want %q", violations, test.violations)
+			}
+		})
+	}
+}
+
+func TestReferenceLoop(t *testing.T) {
+	s, err := Parse([]byte(`{"$ref": "#"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := s.Validate(map[string]interface{}{})
+	if len(found) != 1 || !strings.Contains(found[0].Message, "nested too deeply") {
+		t.Errorf("violations are %v", found)
+	}
+}
+
+func TestParseRejectsInvalidSchemas(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		message string
+	}{
+		{"not a schema", `{"properties": {"a": 1}}`, "#/properties/a: schema must be an object or a boolean"},
+		{"pattern", `{"pattern": "("}`, "#/pattern"},
+		{"unresolvable reference", `{"items": {"$ref": "#/definitions/missing"}}`, "#/items/$ref: unresolvable reference"},
+		{"remote reference", `{"$ref": "http://example.com/schema.json"}`, "only local references"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte(test.schema))
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("parse failed with %v, want %q", err, test.message)
+			}
+		})
+	}
+}